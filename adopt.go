@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const ambiguousFile = "ambiguous.json"
+
+// ambiguousMatch is a task which could be adopted by more than one event, or
+// whose event matches more than one task. Neither side is synced until the
+// user links them with `calwarrior link`.
+type ambiguousMatch struct {
+	Task        string   `json:"task"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`
+}
+
+// normalizeSummary lowercases s and reduces all punctuation and whitespace to
+// single spaces, so trivially different summaries compare equal.
+func normalizeSummary(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// adoptionCandidate reports whether the unsynced event looks like the same
+// item as the unsynced task.
+func adoptionCandidate(task *taskWarriorItem, start taskWarriorTime, event *calendar.Event, tolerance time.Duration) bool {
+	if normalizeSummary(task.Description) != normalizeSummary(event.Summary) {
+		return false
+	}
+
+	taskDue, err := start.ToTime()
+	if err != nil {
+		return false
+	}
+
+	due, err := eventDue(event)
+	if err != nil {
+		return false
+	}
+
+	eventDue, err := due.ToTime()
+	if err != nil {
+		return false
+	}
+
+	diff := taskDue.Sub(eventDue)
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return diff <= tolerance
+}
+
+// adoptEvents links unsynced tasks to pre-existing unsynced events that
+// match them, instead of creating a second event for each. Matches that are
+// not one-to-one are reported and left alone on both sides.
+func (m *merge) adoptEvents() {
+	if m.ctx.Bool("no-adopt") {
+		return
+	}
+
+	tolerance := m.ctx.Duration("adopt-tolerance")
+
+	events := []*calendar.Event{}
+	for _, event := range m.eventsIDMap {
+		if _, ok := m.taskIDMap[event.Id]; ok || m.ignoredEvents[event.Id] || eventTaskUUID(event) != "" {
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	taskMatches := map[*taskWarriorItem][]*calendar.Event{}
+	eventMatches := map[string][]*taskWarriorItem{}
+
+	for _, task := range m.unsyncedTasks {
+		if task.Status != "pending" {
+			continue
+		}
+
+		for _, event := range events {
+			if adoptionCandidate(task, m.fields.eventDate(task), event, tolerance) {
+				taskMatches[task] = append(taskMatches[task], event)
+				eventMatches[event.Id] = append(eventMatches[event.Id], task)
+			}
+		}
+	}
+
+	ambiguous := []ambiguousMatch{}
+	unsynced := taskWarriorItems{}
+
+	for _, task := range m.unsyncedTasks {
+		matches := taskMatches[task]
+		if len(matches) == 0 {
+			unsynced = append(unsynced, task)
+			continue
+		}
+
+		if len(matches) == 1 && len(eventMatches[matches[0].Id]) == 1 {
+			event := matches[0]
+			m.log.Noticef("Adopting existing event %q for task %q (%.20q)", event.Id, task.UUID, task.Description)
+			m.taskIDMap[event.Id] = task
+			task.CalendarID = event.Id
+			m.updateTask(task)
+			continue
+		}
+
+		match := ambiguousMatch{Task: task.UUID, Description: task.Description}
+		ids := []string{}
+		for _, event := range matches {
+			match.Events = append(match.Events, event.Id)
+			ids = append(ids, event.Id)
+			m.ignoredEvents[event.Id] = true
+		}
+
+		// leaving the task out of unsyncedTasks and ignoring the events keeps
+		// either side from being duplicated until the user decides.
+		m.report.addConflict(task, nil, fmt.Sprintf("ambiguous match with events %s; resolve with `calwarrior link`", strings.Join(ids, ", ")))
+		m.log.Warnf("Task %q (%.20q) matches several events (%s); not syncing it until linked with `calwarrior link`", task.UUID, task.Description, strings.Join(ids, ", "))
+		ambiguous = append(ambiguous, match)
+	}
+
+	m.unsyncedTasks = unsynced
+
+	// the matches are only kept for `calwarrior link`, so the sync goes on
+	// without them.
+	if err := saveState(ambiguousFile, ambiguous); err != nil {
+		m.itemFailed(nil, nil, fmt.Errorf("Could not save the ambiguous matches: %w", err))
+	}
+}
+
+// link links a task to an event by hand, or lists the ambiguous matches from
+// the last sync when called without arguments.
+func (ctx *cliContext) link() error {
+	ambiguous := []ambiguousMatch{}
+	if err := loadState(ambiguousFile, &ambiguous); err != nil {
+		return err
+	}
+
+	if ctx.NArg() == 0 {
+		for _, match := range ambiguous {
+			fmt.Printf("%s (%q): %s\n", match.Task, match.Description, strings.Join(match.Events, " "))
+		}
+		return nil
+	}
+
+	if ctx.NArg() != 2 {
+		return errors.New("usage: calwarrior link [task-uuid event-id]")
+	}
+
+	uuid, calID := ctx.Args().Get(0), ctx.Args().Get(1)
+
+	log, err := ctx.makeLogger()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := ctx.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	dates, err := ctx.dates(cfg)
+	if err != nil {
+		return err
+	}
+
+	fields, err := newFieldMap(cfg, dates)
+	if err != nil {
+		return err
+	}
+	fields.manageTags(ctx.managedTags()...)
+
+	runCtx, cancel := ctx.runContext()
+	defer cancel()
+
+	lock, err := acquireSyncLock(runCtx, ctx.Bool("wait"), log)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	tw, cal, err := ctx.connect(runCtx, cfg, log)
+	if err != nil {
+		return exitWith(err, nil)
+	}
+
+	if err := fields.resolveColors(runCtx, cal); err != nil {
+		return exitWith(err, nil)
+	}
+
+	tasks, err := tw.exportTasksByCommand(runCtx, uuid, "export")
+	if err != nil {
+		return exitWith(err, nil)
+	}
+
+	if len(tasks) != 1 {
+		return fmt.Errorf("Could not find task %q", uuid)
+	}
+
+	event, err := cal.getEvent(runCtx, calID)
+	if err != nil {
+		return exitWith(calendarFailure(fmt.Errorf("Could not retrieve event %q: %w", calID, err)), nil)
+	}
+
+	task := tasks[0]
+	if _, err := unify(fields, task, event); err != nil {
+		return fmt.Errorf("Error reconciling task and event: %w", err)
+	}
+
+	if _, err := cal.modifyEvent(runCtx, event); err != nil {
+		return exitWith(calendarFailure(fmt.Errorf("Error modifying calendar event: %w", err)), nil)
+	}
+
+	if err := tw.importTasks(tasks); err != nil {
+		return exitWith(taskwarriorFailure(fmt.Errorf("Could not import tasks: %w", err)), nil)
+	}
+
+	log.Noticef("Linked task %q (%.20q) to event %q", task.UUID, task.Description, event.Id)
+
+	remaining := []ambiguousMatch{}
+	for _, match := range ambiguous {
+		if match.Task != task.UUID {
+			remaining = append(remaining, match)
+		}
+	}
+
+	return saveState(ambiguousFile, remaining)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// annotations are kept in a block at the end of the event description,
+// delimited by these lines. Anything outside the block belongs to the user.
+const (
+	annotationsBegin = "--- taskwarrior annotations ---"
+	annotationsEnd   = "--- end taskwarrior annotations ---"
+)
+
+var (
+	htmlBreakRegexp = regexp.MustCompile(`(?i)<br\s*/?>|</?(p|div)>`)
+	htmlTagRegexp   = regexp.MustCompile(`<[^>]+>`)
+)
+
+// escaped annotations are kept on one line, cannot contain the delimiters
+// (no two dashes in a row), and have no markup which would make a plain text
+// description look like HTML.
+var annotationEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "--", `-\-`, "<", `\l`, "&", `\a`)
+
+var annotationUnescapes = map[byte]byte{'n': '\n', 'l': '<', 'a': '&'}
+
+func escapeAnnotation(s string) string {
+	return annotationEscaper.Replace(s)
+}
+
+func unescapeAnnotation(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if c, ok := annotationUnescapes[s[i]]; ok {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// encodeAnnotations is the form annotations are compared in: one per line,
+// as the entry time followed by the escaped description.
+func encodeAnnotations(annotations []taskWarriorAnnotation) string {
+	lines := []string{}
+	for _, annotation := range annotations {
+		lines = append(lines, string(annotation.Entry)+" "+escapeAnnotation(annotation.Description))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func decodeAnnotations(s string) []taskWarriorAnnotation {
+	var annotations []taskWarriorAnnotation
+
+	for _, line := range strings.Split(s, "\n") {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		annotations = append(annotations, taskWarriorAnnotation{
+			Entry:       taskWarriorTime(parts[0]),
+			Description: unescapeAnnotation(parts[1]),
+		})
+	}
+
+	return annotations
+}
+
+// splitDescription separates the user's text from the annotations block.
+// Descriptions edited in the calendar's web interface may have been turned
+// into HTML; in that case the block is converted back to plain text.
+func splitDescription(description string) (string, []string) {
+	isHTML := htmlBreakRegexp.MatchString(description)
+	if isHTML {
+		description = htmlBreakRegexp.ReplaceAllString(description, "\n")
+	}
+
+	begin := strings.Index(description, annotationsBegin)
+	if begin < 0 {
+		return strings.TrimSpace(description), nil
+	}
+
+	user := description[:begin]
+	block := description[begin+len(annotationsBegin):]
+
+	if end := strings.Index(block, annotationsEnd); end >= 0 {
+		user += block[end+len(annotationsEnd):]
+		block = block[:end]
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(block, "\n") {
+		if isHTML {
+			line = html.UnescapeString(htmlTagRegexp.ReplaceAllString(line, ""))
+		}
+
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.TrimSpace(user), lines
+}
+
+func joinDescription(user string, block []string) string {
+	if len(block) == 0 {
+		return user
+	}
+
+	parts := []string{}
+	if user != "" {
+		parts = append(parts, user, "")
+	}
+
+	parts = append(parts, annotationsBegin)
+	parts = append(parts, block...)
+	parts = append(parts, annotationsEnd)
+
+	return strings.Join(parts, "\n")
+}
+
+// eventAnnotations reads the annotations block of the event. Lines without a
+// timestamp (for example, added by hand in the calendar) take the time the
+// event was last updated.
+func eventAnnotations(event *calendar.Event) string {
+	_, lines := splitDescription(event.Description)
+
+	fallback, err := calendarTime(event.Updated).ToTaskWarriorTime()
+	if err != nil {
+		fallback = toTaskWarriorTime(time.Unix(0, 0))
+	}
+
+	annotations := []taskWarriorAnnotation{}
+	for _, line := range lines {
+		annotation := taskWarriorAnnotation{Entry: fallback, Description: unescapeAnnotation(line)}
+
+		if strings.HasPrefix(line, "[") {
+			if end := strings.Index(line, "] "); end > 0 {
+				if t, err := time.Parse(time.RFC3339, line[1:end]); err == nil {
+					annotation.Entry = toTaskWarriorTime(t.UTC())
+					annotation.Description = unescapeAnnotation(line[end+2:])
+				}
+			}
+		}
+
+		annotations = append(annotations, annotation)
+	}
+
+	return encodeAnnotations(annotations)
+}
+
+func setEventAnnotations(event *calendar.Event, value string) {
+	user, _ := splitDescription(event.Description)
+
+	lines := []string{}
+	for _, annotation := range decodeAnnotations(value) {
+		line := escapeAnnotation(annotation.Description)
+		if t, err := annotation.Entry.ToTime(); err == nil {
+			line = "[" + t.UTC().Format(time.RFC3339) + "] " + line
+		}
+		lines = append(lines, line)
+	}
+
+	event.Description = joinDescription(user, lines)
+}
+
+// eventUserDescription is the description without the annotations block.
+func eventUserDescription(event *calendar.Event) string {
+	user, _ := splitDescription(event.Description)
+	return user
+}
+
+func setEventUserDescription(event *calendar.Event, value string) {
+	_, block := splitDescription(event.Description)
+	event.Description = joinDescription(strings.TrimSpace(value), block)
+}
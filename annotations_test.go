@@ -0,0 +1,74 @@
+package main
+
+import (
+	"html"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestAnnotationsRoundTrip(t *testing.T) {
+	table := []struct {
+		name        string
+		description string
+	}{
+		{"plain", "Call Bob about the venue"},
+		{"end delimiter", annotationsEnd},
+		{"begin delimiter", annotationsBegin},
+		{"delimiter within text", "see " + annotationsEnd + " below"},
+		{"dashes", "a ---- b ----- c -"},
+		{"paragraph", "<p>draft</p>"},
+		{"line break", "first<br>second<BR/>third"},
+		{"division", "<div>boxed</div>"},
+		{"entities", "fish &amp; chips &lt;3"},
+		{"escapes", `C:\new\table \n \l \a`},
+		{"newlines", "one\ntwo\n\nthree"},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			annotations := []taskWarriorAnnotation{
+				{Entry: "20210601T090000Z", Description: test.description},
+				{Entry: "20210601T100000Z", Description: "second note"},
+			}
+
+			event := &calendar.Event{Description: "my notes"}
+			setEventAnnotations(event, encodeAnnotations(annotations))
+
+			if htmlBreakRegexp.MatchString(event.Description) {
+				t.Fatalf("description looks like HTML: %q", event.Description)
+			}
+
+			if user := eventUserDescription(event); user != "my notes" {
+				t.Fatalf("expected the user's text to be kept, got %q", user)
+			}
+
+			got := decodeAnnotations(eventAnnotations(event))
+			if len(got) != len(annotations) {
+				t.Fatalf("expected %d annotations, got %#v from %q", len(annotations), got, event.Description)
+			}
+
+			for i := range annotations {
+				if got[i] != annotations[i] {
+					t.Fatalf("expected %#v, got %#v from %q", annotations[i], got[i], event.Description)
+				}
+			}
+		})
+	}
+}
+
+func TestAnnotationsHTMLDescription(t *testing.T) {
+	annotations := []taskWarriorAnnotation{{Entry: "20210601T090000Z", Description: "<b>bold</b> & " + annotationsEnd}}
+
+	event := &calendar.Event{}
+	setEventAnnotations(event, encodeAnnotations(annotations))
+
+	// the calendar's web interface turns the description into HTML when edited
+	event.Description = "<p>my notes</p>" + strings.ReplaceAll(html.EscapeString(event.Description), "\n", "<br>")
+
+	got := decodeAnnotations(eventAnnotations(event))
+	if len(got) != 1 || got[0] != annotations[0] {
+		t.Fatalf("expected %#v, got %#v from %q", annotations, got, event.Description)
+	}
+}
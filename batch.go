@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	batchSize    = 50 // google's limit for calendar batches
+	batchRetries = 5
+)
+
+// batchOp is a single write in a calendar batch. done is called with the
+// result once the batch has been executed.
+type batchOp struct {
+	method string
+	path   string
+	event  *calendar.Event
+	done   func(*calendar.Event, error)
+}
+
+// calendarBatch collects calendar writes so they can be sent in as few HTTP
+// requests as possible.
+type calendarBatch struct {
+	ops []*batchOp
+}
+
+func eventsPath(calID string) string {
+	return "calendars/" + url.PathEscape(calID) + "/events"
+}
+
+func (b *calendarBatch) insert(event *calendar.Event, done func(*calendar.Event, error)) {
+	b.insertIn("primary", event, done)
+}
+
+func (b *calendarBatch) insertIn(calID string, event *calendar.Event, done func(*calendar.Event, error)) {
+	b.ops = append(b.ops, &batchOp{method: http.MethodPost, path: eventsPath(calID), event: event, done: done})
+}
+
+func (b *calendarBatch) modify(event *calendar.Event, done func(*calendar.Event, error)) {
+	b.ops = append(b.ops, &batchOp{method: http.MethodPatch, path: eventsPath("primary") + "/" + url.PathEscape(event.Id), event: event, done: done})
+}
+
+func (b *calendarBatch) delete(calID string, done func(error)) {
+	b.ops = append(b.ops, &batchOp{
+		method: http.MethodDelete,
+		path:   eventsPath("primary") + "/" + url.PathEscape(calID),
+		done:   func(_ *calendar.Event, err error) { done(err) },
+	})
+}
+
+// batchURL derives the batch endpoint from the service's base path, e.g.
+// https://www.googleapis.com/calendar/v3/ -> https://www.googleapis.com/batch/calendar/v3
+// It also returns the path prefix for the individual requests.
+func (cal *calendarClient) batchURL() (*url.URL, string, error) {
+	u, err := url.Parse(cal.BasePath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	prefix := strings.TrimSuffix(u.Path, "/")
+	u.Path = "/batch" + prefix
+	return u, prefix, nil
+}
+
+// runBatch executes the batch in chunks of batchSize, calling each
+// operation's done function with its result. Operations that were rate
+// limited or hit a server error are retried in a later request, until waiting
+// for it would exceed the retry budget; they then get their last response.
+// If a batch request fails as a whole, done receives that error for each of
+// its operations.
+func (cal *calendarClient) runBatch(ctx context.Context, b *calendarBatch) {
+	pending := b.ops
+	b.ops = nil
+
+	start := time.Now()
+
+	for round := 0; len(pending) > 0; round++ {
+		retry := []*batchOp{}
+		last := map[*batchOp]*http.Response{}
+		var delay time.Duration
+
+		for i := 0; i < len(pending); i += batchSize {
+			end := i + batchSize
+			if end > len(pending) {
+				end = len(pending)
+			}
+
+			chunk := pending[i:end]
+
+			responses, err := cal.sendBatch(ctx, chunk)
+			if err != nil {
+				for _, op := range chunk {
+					op.done(nil, err)
+				}
+				continue
+			}
+
+			for i, op := range chunk {
+				resp := responses[i]
+				if resp == nil {
+					op.done(nil, errors.New("no response in batch for request"))
+					continue
+				}
+
+				if round < batchRetries && retryable(resp) {
+					if d := retryDelay(resp, round); d > delay {
+						delay = d
+					}
+					retry = append(retry, op)
+					last[op] = resp
+					continue
+				}
+
+				op.done(decodeBatchResponse(resp))
+			}
+		}
+
+		if len(retry) > 0 && time.Since(start)+delay > cal.retryBudget {
+			for _, op := range retry {
+				op.done(decodeBatchResponse(last[op]))
+			}
+			return
+		}
+
+		pending = retry
+		if len(pending) > 0 {
+			select {
+			case <-ctx.Done():
+				for _, op := range pending {
+					op.done(nil, ctx.Err())
+				}
+				return
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+// sendBatch sends one multipart batch request and returns the responses in
+// the order of ops.
+func (cal *calendarClient) sendBatch(ctx context.Context, ops []*batchOp) ([]*http.Response, error) {
+	u, prefix, err := cal.batchURL()
+	if err != nil {
+		return nil, err
+	}
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+
+	for i, op := range ops {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/http"},
+			"Content-Id":   {fmt.Sprintf("<item-%d>", i)},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(part, "%s %s/%s HTTP/1.1\r\n", op.method, prefix, op.path)
+
+		if op.event != nil {
+			content, err := json.Marshal(op.event)
+			if err != nil {
+				return nil, err
+			}
+
+			fmt.Fprintf(part, "Content-Type: application/json\r\nContent-Length: %d\r\n\r\n", len(content))
+			part.Write(content)
+		} else {
+			fmt.Fprintf(part, "\r\n")
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+
+	resp, err := cal.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Trouble sending calendar batch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, fmt.Errorf("Calendar batch failed: %w", err)
+	}
+
+	return parseBatchResponse(resp, len(ops))
+}
+
+// parseBatchResponse maps each part of the multipart response back to the
+// request it answers via its Content-ID.
+func parseBatchResponse(resp *http.Response, count int) ([]*http.Response, error) {
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid batch response content type: %w", err)
+	}
+
+	responses := make([]*http.Response, count)
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Trouble reading batch response: %w", err)
+		}
+
+		// google answers <item-N> with <response-item-N>
+		id := strings.Trim(part.Header.Get("Content-Id"), "<>")
+		i, err := strconv.Atoi(strings.TrimPrefix(id, "response-item-"))
+		if err != nil || i < 0 || i >= count {
+			continue
+		}
+
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("Trouble reading batch response: %w", err)
+		}
+
+		sub, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(content)), nil)
+		if err != nil {
+			return nil, fmt.Errorf("Trouble parsing batch response: %w", err)
+		}
+
+		responses[i] = sub
+	}
+
+	return responses, nil
+}
+
+func decodeBatchResponse(resp *http.Response) (*calendar.Event, error) {
+	defer resp.Body.Close()
+
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	event := &calendar.Event{}
+	if err := json.NewDecoder(resp.Body).Decode(event); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Trouble decoding batch response: %w", err)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// batchPart is a request found in a batch, and the response to send for it.
+type batchPart struct {
+	id, method, path, body string
+
+	status     int
+	retryAfter string
+	response   string
+}
+
+// fakeBatch answers calendar batches, asking answer for the response to
+// each part. Parts are answered in reverse order, as google does not promise
+// to keep it.
+type fakeBatch struct {
+	mutex   sync.Mutex
+	batches [][]batchPart
+}
+
+func (fb *fakeBatch) client(t *testing.T, answer func(batch int, part *batchPart)) *calendarClient {
+	return newTestCalendarClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts, err := readBatch(r)
+		if err != nil || r.Method != http.MethodPost || r.URL.Path != "/batch" {
+			http.Error(w, fmt.Sprintf("bad batch %s %s: %v", r.Method, r.URL.Path, err), http.StatusBadRequest)
+			return
+		}
+
+		fb.mutex.Lock()
+		batch := len(fb.batches)
+		for i := range parts {
+			answer(batch, &parts[i])
+		}
+		fb.batches = append(fb.batches, parts)
+		fb.mutex.Unlock()
+
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+
+		for i := len(parts) - 1; i >= 0; i-- {
+			part := parts[i]
+
+			pw, _ := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type": {"application/http"},
+				"Content-Id":   {"<response-" + part.id + ">"},
+			})
+
+			fmt.Fprintf(pw, "HTTP/1.1 %d %s\r\nContent-Type: application/json\r\n", part.status, http.StatusText(part.status))
+			if part.retryAfter != "" {
+				fmt.Fprintf(pw, "Retry-After: %s\r\n", part.retryAfter)
+			}
+			fmt.Fprintf(pw, "Content-Length: %d\r\n\r\n%s", len(part.response), part.response)
+		}
+
+		mw.Close()
+	}))
+}
+
+func readBatch(r *http.Request) ([]batchPart, error) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	parts := []batchPart{}
+	mr := multipart.NewReader(r.Body, params["boundary"])
+
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return parts, nil
+		}
+
+		if part.Header.Get("Content-Type") != "application/http" {
+			return nil, fmt.Errorf("unexpected part content type %q", part.Header.Get("Content-Type"))
+		}
+
+		req, err := http.ReadRequest(bufio.NewReader(part))
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, batchPart{
+			id:     strings.Trim(part.Header.Get("Content-Id"), "<>"),
+			method: req.Method,
+			path:   req.URL.Path,
+			body:   string(body),
+		})
+	}
+}
+
+type batchResult struct {
+	event *calendar.Event
+	err   error
+}
+
+func (br *batchResult) done(event *calendar.Event, err error) {
+	br.event, br.err = event, err
+}
+
+func TestRunBatchRequests(t *testing.T) {
+	fb := &fakeBatch{}
+	cal := fb.client(t, func(_ int, part *batchPart) {
+		part.status = http.StatusOK
+		part.response = `{"id":"` + part.id + `"}`
+		if part.method == http.MethodDelete {
+			part.status, part.response = http.StatusNoContent, ""
+		}
+	})
+
+	results := make([]batchResult, 4)
+	deleted := false
+
+	b := &calendarBatch{}
+	b.insert(&calendar.Event{Summary: "new"}, results[0].done)
+	b.insertIn("work@example.com", &calendar.Event{Summary: "logged"}, results[1].done)
+	b.modify(&calendar.Event{Id: "abc", Summary: "changed"}, results[2].done)
+	b.delete("def", func(err error) { deleted, results[3].err = true, err })
+
+	cal.runBatch(context.Background(), b)
+
+	if len(fb.batches) != 1 {
+		t.Fatalf("expected one batch, got %d", len(fb.batches))
+	}
+
+	want := []batchPart{
+		{id: "item-0", method: "POST", path: "/calendars/primary/events", body: `{"summary":"new"}`},
+		{id: "item-1", method: "POST", path: "/calendars/work@example.com/events", body: `{"summary":"logged"}`},
+		{id: "item-2", method: "PATCH", path: "/calendars/primary/events/abc", body: `{"id":"abc","summary":"changed"}`},
+		{id: "item-3", method: "DELETE", path: "/calendars/primary/events/def"},
+	}
+
+	for i, part := range fb.batches[0] {
+		part.status, part.response = 0, ""
+		if part != want[i] {
+			t.Fatalf("expected part %d to be %+v, got %+v", i, want[i], part)
+		}
+	}
+
+	for i, result := range results[:3] {
+		if result.err != nil || result.event == nil || result.event.Id != want[i].id {
+			t.Fatalf("expected operation %d to get the response to %s, got %+v", i, want[i].id, result)
+		}
+	}
+
+	if !deleted || results[3].err != nil {
+		t.Fatalf("expected the delete to succeed, got %v", results[3].err)
+	}
+}
+
+func TestRunBatchMixedResponses(t *testing.T) {
+	fb := &fakeBatch{}
+	cal := fb.client(t, func(batch int, part *batchPart) {
+		switch {
+		case strings.HasSuffix(part.path, "/missing"):
+			part.status, part.response = http.StatusNotFound, `{"error":{"code":404,"message":"Not Found"}}`
+		case strings.HasSuffix(part.path, "/busy") && batch == 0:
+			part.status, part.retryAfter, part.response = http.StatusTooManyRequests, "0", `{"error":{"code":429,"message":"Rate Limit Exceeded"}}`
+		default:
+			part.status, part.response = http.StatusOK, `{"id":"`+strings.TrimPrefix(part.path, "/calendars/primary/events/")+`"}`
+		}
+	})
+	cal.retryBudget = time.Minute
+
+	results := make([]batchResult, 3)
+
+	b := &calendarBatch{}
+	for i, id := range []string{"found", "missing", "busy"} {
+		b.modify(&calendar.Event{Id: id}, results[i].done)
+	}
+
+	cal.runBatch(context.Background(), b)
+
+	if results[0].err != nil || results[0].event.Id != "found" {
+		t.Fatalf("expected the first event to be modified, got %+v", results[0])
+	}
+
+	if !isGone(results[1].err) {
+		t.Fatalf("expected the second event to be gone, got %v", results[1].err)
+	}
+
+	if results[2].err != nil || results[2].event.Id != "busy" {
+		t.Fatalf("expected the rate limited event to be modified on retry, got %+v", results[2])
+	}
+
+	if len(fb.batches) != 2 || len(fb.batches[1]) != 1 || fb.batches[1][0].path != "/calendars/primary/events/busy" {
+		t.Fatalf("expected only the rate limited event to be retried, got %+v", fb.batches)
+	}
+}
+
+func TestRunBatchRetryBudget(t *testing.T) {
+	fb := &fakeBatch{}
+	cal := fb.client(t, func(_ int, part *batchPart) {
+		part.status, part.retryAfter, part.response = http.StatusTooManyRequests, "60", `{"error":{"code":429,"message":"Rate Limit Exceeded"}}`
+	})
+	cal.retryBudget = time.Second
+
+	result := batchResult{}
+	b := &calendarBatch{}
+	b.modify(&calendar.Event{Id: "busy"}, result.done)
+
+	start := time.Now()
+	cal.runBatch(context.Background(), b)
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected the retry budget to bound the batch, took %v", elapsed)
+	}
+
+	if len(fb.batches) != 1 {
+		t.Fatalf("expected no retry beyond the budget, got %d batches", len(fb.batches))
+	}
+
+	if result.err == nil || !strings.Contains(result.err.Error(), "429") {
+		t.Fatalf("expected the rate limit error, got %v", result.err)
+	}
+}
+
+func TestRunBatchRetryRounds(t *testing.T) {
+	fb := &fakeBatch{}
+	cal := fb.client(t, func(_ int, part *batchPart) {
+		part.status, part.retryAfter, part.response = http.StatusServiceUnavailable, "0", `{"error":{"code":503,"message":"Backend Error"}}`
+	})
+	cal.retryBudget = time.Minute
+
+	result := batchResult{}
+	b := &calendarBatch{}
+	b.delete("flaky", func(err error) { result.err = err })
+
+	cal.runBatch(context.Background(), b)
+
+	if len(fb.batches) != batchRetries+1 {
+		t.Fatalf("expected %d attempts, got %d", batchRetries+1, len(fb.batches))
+	}
+
+	if result.err == nil {
+		t.Fatal("expected the last error once out of retries")
+	}
+}
+
+func TestRunBatchFailure(t *testing.T) {
+	cal := newTestCalendarClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"code":400,"message":"Bad Request"}}`, http.StatusBadRequest)
+	}))
+
+	results := make([]batchResult, 2)
+	b := &calendarBatch{}
+	b.insert(&calendar.Event{}, results[0].done)
+	b.insert(&calendar.Event{}, results[1].done)
+
+	cal.runBatch(context.Background(), b)
+
+	for i, result := range results {
+		if result.err == nil || !strings.Contains(result.err.Error(), "Calendar batch failed") {
+			t.Fatalf("expected operation %d to get the batch error, got %v", i, result.err)
+		}
+	}
+}
+
+func TestRunBatchChunks(t *testing.T) {
+	fb := &fakeBatch{}
+	cal := fb.client(t, func(_ int, part *batchPart) {
+		part.status, part.response = http.StatusOK, `{"id":"`+part.id+`"}`
+	})
+
+	results := make([]batchResult, batchSize+1)
+	b := &calendarBatch{}
+	for i := range results {
+		b.insert(&calendar.Event{}, results[i].done)
+	}
+
+	cal.runBatch(context.Background(), b)
+
+	if len(fb.batches) != 2 || len(fb.batches[0]) != batchSize || len(fb.batches[1]) != 1 {
+		t.Fatalf("expected batches of %d and 1", batchSize)
+	}
+
+	if results[batchSize].event == nil || results[batchSize].event.Id != "item-0" {
+		t.Fatalf("expected the last operation to get the first response of the second batch, got %+v", results[batchSize])
+	}
+}
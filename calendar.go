@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"time"
 
 	"golang.org/x/oauth2/google"
@@ -10,45 +12,73 @@ import (
 
 type calendarClient struct {
 	*calendar.Service
+	client      *http.Client
+	retryBudget time.Duration
 }
 
-func getCalendarClient() (*calendarClient, error) {
+// getCalendarClient constructs the calendar client. Requests that are rate
+// limited or fail with a server error are retried until retryBudget is spent.
+func getCalendarClient(ctx context.Context, retryBudget time.Duration, log logger) (*calendarClient, error) {
 	// If modifying these scopes, delete your previously saved token.json.
 	config, err := google.ConfigFromJSON(CredentialJSON, calendar.CalendarScope)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to parse client secret file to config: %w", err)
+		return nil, authFailure(fmt.Errorf("Unable to parse client secret file to config: %w", err))
 	}
 
-	client, err := getClient(config)
+	client, err := getClient(ctx, config)
 	if err != nil {
-		return nil, fmt.Errorf("Trouble while gathering client information: %w", err)
+		return nil, authFailure(fmt.Errorf("Trouble while gathering client information: %w", err))
 	}
 
+	client.Transport = newRetryTransport(client.Transport, retryBudget, log)
+
 	srv, err := calendar.New(client)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to retrieve Calendar client: %w", err)
+		return nil, calendarFailure(fmt.Errorf("Unable to retrieve Calendar client: %w", err))
 	}
 
-	return &calendarClient{srv}, nil
+	return &calendarClient{Service: srv, client: client, retryBudget: retryBudget}, nil
 }
 
-func (cal *calendarClient) gatherEvents(t1, t2 time.Time) (*calendar.Events, error) {
-	return cal.Events.List("primary").ShowDeleted(false).
-		SingleEvents(true).TimeMin(string(toCalendarTime(t1))).TimeMax(string(toCalendarTime(t2))).OrderBy("startTime").Do()
+// gatherEvents lists the events between t1 and t2, across all result pages.
+func (cal *calendarClient) gatherEvents(ctx context.Context, t1, t2 time.Time) (*calendar.Events, error) {
+	call := cal.Events.List("primary").ShowDeleted(false).MaxResults(2500).
+		SingleEvents(true).TimeMin(string(toCalendarTime(t1))).TimeMax(string(toCalendarTime(t2))).OrderBy("startTime").Context(ctx)
+
+	var events *calendar.Events
+
+	for {
+		page, err := call.Do()
+		if err != nil {
+			return nil, err
+		}
+
+		if events == nil {
+			events = page
+		} else {
+			events.Items = append(events.Items, page.Items...)
+		}
+
+		if page.NextPageToken == "" {
+			events.NextPageToken = ""
+			return events, nil
+		}
+		call.PageToken(page.NextPageToken)
+	}
 }
 
-func (cal *calendarClient) insertEvent(event *calendar.Event) (*calendar.Event, error) {
-	return cal.Events.Insert("primary", event).Do()
+func (cal *calendarClient) insertEvent(ctx context.Context, event *calendar.Event) (*calendar.Event, error) {
+	return cal.Events.Insert("primary", event).Context(ctx).Do()
 }
 
-func (cal *calendarClient) modifyEvent(event *calendar.Event) (*calendar.Event, error) {
-	return cal.Events.Patch("primary", event.Id, event).Do()
+func (cal *calendarClient) modifyEvent(ctx context.Context, event *calendar.Event) (*calendar.Event, error) {
+	return cal.Events.Patch("primary", event.Id, event).Context(ctx).Do()
 }
 
-func (cal *calendarClient) getEvent(calID string) (*calendar.Event, error) {
-	return cal.Events.Get("primary", calID).Do()
+func (cal *calendarClient) getEvent(ctx context.Context, calID string) (*calendar.Event, error) {
+	return cal.Events.Get("primary", calID).Context(ctx).Do()
 }
 
-func (cal *calendarClient) deleteEvent(calID string) error {
-	return cal.Events.Delete("primary", calID).Do()
+func (cal *calendarClient) deleteEvent(ctx context.Context, calID string) error {
+	return cal.Events.Delete("primary", calID).Context(ctx).Do()
 }
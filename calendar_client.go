@@ -55,7 +55,7 @@ func init() {
 }
 
 // Retrieve a token, saves the token, then returns the generated client.
-func getClient(config *oauth2.Config) (*http.Client, error) {
+func getClient(ctx context.Context, config *oauth2.Config) (*http.Client, error) {
 	dir, err := findSettingsDir()
 	if err != nil {
 		return nil, err
@@ -64,28 +64,28 @@ func getClient(config *oauth2.Config) (*http.Client, error) {
 	tokFile := filepath.Join(dir, tokenFile)
 	tok, err := tokenFromFile(tokFile)
 	if err != nil {
-		tok = getTokenFromWeb(config)
+		tok = getTokenFromWeb(ctx, config)
 		saveToken(tokFile, tok)
 	}
-	return config.Client(context.Background(), tok), nil
+	return config.Client(ctx, tok), nil
 }
 
 // Request a token from the web, then returns the retrieved token.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
+func getTokenFromWeb(ctx context.Context, config *oauth2.Config) *oauth2.Token {
 	tool, useTool := findLauncher()
 
 	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
 	if useTool {
-		fmt.Println("The browser will now open; accept the prompts and type the authorization code:")
+		fmt.Fprintln(os.Stderr, "The browser will now open; accept the prompts and type the authorization code:")
 
 		if err := exec.Command(tool, authURL).Run(); err != nil {
-			fmt.Printf("Error launching detected URL launcher: %v -- continuing in manual mode\n", tool)
+			fmt.Fprintf(os.Stderr, "Error launching detected URL launcher: %v -- continuing in manual mode\n", tool)
 			useTool = false
 		}
 	}
 
 	if !useTool {
-		fmt.Printf("Go to the following link in your browser then type the "+
+		fmt.Fprintf(os.Stderr, "Go to the following link in your browser then type the "+
 			"authorization code: \n%v\n", authURL)
 	}
 
@@ -94,7 +94,7 @@ func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
 		log.Fatalf("Unable to read authorization code: %v", err)
 	}
 
-	tok, err := config.Exchange(context.TODO(), authCode)
+	tok, err := config.Exchange(ctx, authCode)
 	if err != nil {
 		log.Fatalf("Unable to retrieve token from web: %v", err)
 	}
@@ -115,7 +115,7 @@ func tokenFromFile(file string) (*oauth2.Token, error) {
 
 // Saves a token to a file path.
 func saveToken(path string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", path)
+	fmt.Fprintf(os.Stderr, "Saving credential file to: %s\n", path)
 	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		log.Fatalf("Unable to cache oauth token: %v", err)
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+// newTestCalendarClient returns a calendar client talking to handler.
+func newTestCalendarClient(t *testing.T, handler http.Handler) *calendarClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	srv, err := calendar.NewService(context.Background(), option.WithHTTPClient(server.Client()), option.WithEndpoint(server.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &calendarClient{Service: srv, client: server.Client()}
+}
+
+func TestGatherEventsPages(t *testing.T) {
+	cal := newTestCalendarClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Query().Get("pageToken") {
+		case "":
+			fmt.Fprint(w, `{"items":[{"id":"one"},{"id":"two"}],"nextPageToken":"p2"}`)
+		case "p2":
+			fmt.Fprint(w, `{"items":[{"id":"three"}]}`)
+		default:
+			http.Error(w, "unknown page", http.StatusBadRequest)
+		}
+	}))
+
+	events, err := cal.gatherEvents(context.Background(), time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	for _, event := range events.Items {
+		ids = append(ids, event.Id)
+	}
+
+	if fmt.Sprint(ids) != "[one two three]" {
+		t.Fatalf("expected the events of both pages, got %v", ids)
+	}
+}
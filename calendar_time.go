@@ -7,6 +7,13 @@ import (
 	"google.golang.org/api/calendar/v3"
 )
 
+// calendar times without an explicit offset; google permits these when the
+// event carries a time zone.
+const calendarLocalTimeFormat = "2006-01-02T15:04:05"
+
+// the date of all-day events
+const calendarDateFormat = "2006-01-02"
+
 type (
 	calendarDate string
 	calendarTime string
@@ -14,6 +21,7 @@ type (
 
 type calendarPeriod interface {
 	ToTaskWarriorTime() (taskWarriorTime, error)
+	ToTaskWarriorTimeIn(*time.Location) (taskWarriorTime, error)
 }
 
 func toCalendarTime(t time.Time) calendarTime {
@@ -21,7 +29,23 @@ func toCalendarTime(t time.Time) calendarTime {
 }
 
 func toCalendarDate(t time.Time) calendarDate {
-	return calendarDate(t.Format(time.RFC3339))
+	return calendarDate(t.Format(calendarDateFormat))
+}
+
+// eventLocation returns the time zone the event time was scheduled in. If
+// the event does not carry one (or it is unknown to this system), the local
+// zone is used.
+func eventLocation(edt *calendar.EventDateTime) *time.Location {
+	if edt == nil || edt.TimeZone == "" {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(edt.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+
+	return loc
 }
 
 func eventToCalendarPeriod(event *calendar.Event) (calendarPeriod, error) {
@@ -30,7 +54,9 @@ func eventToCalendarPeriod(event *calendar.Event) (calendarPeriod, error) {
 		err    error
 	)
 
-	if event.Start.DateTime != "" {
+	if event.Start == nil {
+		err = errors.New("no date to convert")
+	} else if event.Start.DateTime != "" {
 		period = calendarTime(event.Start.DateTime)
 	} else if event.Start.Date != "" {
 		period = calendarDate(event.Start.Date)
@@ -54,20 +80,35 @@ func eventDue(event *calendar.Event) (taskWarriorTime, error) {
 		return "", err
 	}
 
-	return period.ToTaskWarriorTime()
+	return period.ToTaskWarriorTimeIn(eventLocation(event.Start))
 }
 
 func (c calendarTime) ToTaskWarriorTime() (taskWarriorTime, error) {
-	parsed, err := time.ParseInLocation(time.RFC3339, string(c), time.Local)
+	return c.ToTaskWarriorTimeIn(time.Local)
+}
+
+// ToTaskWarriorTimeIn converts the time, using loc only when the time does
+// not carry its own offset.
+func (c calendarTime) ToTaskWarriorTimeIn(loc *time.Location) (taskWarriorTime, error) {
+	parsed, err := time.ParseInLocation(time.RFC3339, string(c), loc)
 	if err != nil {
-		return "", err
+		var err2 error
+		parsed, err2 = time.ParseInLocation(calendarLocalTimeFormat, string(c), loc)
+		if err2 != nil {
+			return "", err
+		}
 	}
 
 	return toTaskWarriorTime(parsed.In(time.UTC)), nil
 }
 
 func (c calendarDate) ToTaskWarriorTime() (taskWarriorTime, error) {
-	parsed, err := time.ParseInLocation("2006-01-02", string(c), time.Local)
+	return c.ToTaskWarriorTimeIn(time.Local)
+}
+
+// ToTaskWarriorTimeIn converts the date to midnight in loc.
+func (c calendarDate) ToTaskWarriorTimeIn(loc *time.Location) (taskWarriorTime, error) {
+	parsed, err := time.ParseInLocation(calendarDateFormat, string(c), loc)
 	if err != nil {
 		return "", err
 	}
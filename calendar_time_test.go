@@ -0,0 +1,142 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestEventDue(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the event zones below differ from the local one
+	local := time.Local
+	time.Local = berlin
+	defer func() { time.Local = local }()
+
+	table := []struct {
+		name  string
+		start *calendar.EventDateTime
+		due   taskWarriorTime
+	}{
+		{
+			name:  "before spring forward",
+			start: &calendar.EventDateTime{DateTime: "2021-03-14T01:30:00", TimeZone: "America/New_York"},
+			due:   "20210314T063000Z",
+		},
+		{
+			name:  "after spring forward",
+			start: &calendar.EventDateTime{DateTime: "2021-03-14T03:30:00", TimeZone: "America/New_York"},
+			due:   "20210314T073000Z",
+		},
+		{
+			name:  "before fall back",
+			start: &calendar.EventDateTime{DateTime: "2021-11-07T00:30:00", TimeZone: "America/New_York"},
+			due:   "20211107T043000Z",
+		},
+		{
+			name:  "after fall back",
+			start: &calendar.EventDateTime{DateTime: "2021-11-07T03:00:00", TimeZone: "America/New_York"},
+			due:   "20211107T080000Z",
+		},
+		{
+			name:  "offset wins over the event zone",
+			start: &calendar.EventDateTime{DateTime: "2021-03-14T03:30:00-04:00", TimeZone: "Asia/Tokyo"},
+			due:   "20210314T073000Z",
+		},
+		{
+			name:  "event zone differs from local",
+			start: &calendar.EventDateTime{DateTime: "2021-06-01T09:00:00", TimeZone: "America/New_York"},
+			due:   "20210601T130000Z",
+		},
+		{
+			name:  "no offset and no zone",
+			start: &calendar.EventDateTime{DateTime: "2021-06-01T09:00:00"},
+			due:   "20210601T070000Z",
+		},
+		{
+			name:  "unknown zone",
+			start: &calendar.EventDateTime{DateTime: "2021-06-01T09:00:00", TimeZone: "Nowhere/Special"},
+			due:   "20210601T070000Z",
+		},
+		{
+			name:  "date on spring forward",
+			start: &calendar.EventDateTime{Date: "2021-03-14", TimeZone: "America/New_York"},
+			due:   "20210314T050000Z",
+		},
+		{
+			name:  "date on fall back",
+			start: &calendar.EventDateTime{Date: "2021-11-07", TimeZone: "America/New_York"},
+			due:   "20211107T040000Z",
+		},
+		{
+			name:  "date without zone",
+			start: &calendar.EventDateTime{Date: "2021-03-28"},
+			due:   "20210327T230000Z",
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			due, err := eventDue(&calendar.Event{Start: test.start})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if due != test.due {
+				t.Fatalf("expected %s, got %s", test.due, due)
+			}
+		})
+	}
+}
+
+func TestEventDueWithoutDate(t *testing.T) {
+	for _, event := range []*calendar.Event{nil, {}, {Start: &calendar.EventDateTime{}}} {
+		if _, err := eventDue(event); err == nil {
+			t.Fatalf("expected an error for %#v", event)
+		}
+	}
+}
+
+func TestCalendarTimeRoundTrip(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, twt := range []taskWarriorTime{"20210314T063000Z", "20210314T073000Z", "20211107T043000Z", "20211107T080000Z"} {
+		edt, err := twt.ToGCalIn(ny)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if edt.TimeZone != "America/New_York" {
+			t.Fatalf("expected the event zone to be kept, got %q", edt.TimeZone)
+		}
+
+		back, err := eventDue(&calendar.Event{Start: edt})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if back != twt {
+			t.Fatalf("expected %s, got %s (via %s)", twt, back, edt.DateTime)
+		}
+	}
+}
+
+func TestAllDay(t *testing.T) {
+	start, end := allDay(time.Date(2021, 12, 31, 23, 30, 0, 0, time.Local))
+
+	if start.Date != "2021-12-31" || end.Date != "2022-01-01" {
+		t.Fatalf("expected 2021-12-31 to 2022-01-01, got %s to %s", start.Date, end.Date)
+	}
+
+	if start.DateTime != "" || end.DateTime != "" {
+		t.Fatal("all-day events must not have a time")
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"time"
 
 	"github.com/urfave/cli/v2"
@@ -21,28 +24,154 @@ func (ctx *cliContext) makeTags() (taskWarriorTags, error) {
 	return taskWarriorTags(slice), nil
 }
 
+// getTimeWindow returns the window events are gathered in: from --lookback
+// ago until --lookahead from now. Without --lookahead, the window lasts
+// --duration from its start.
 func (ctx *cliContext) getTimeWindow() (time.Time, time.Time) {
-	t1 := time.Now().Add(-time.Hour * 24)
-	t2 := t1.Add(ctx.Duration("duration"))
+	now := time.Now()
+	t1 := now.Add(-ctx.Duration("lookback"))
 
-	return t1, t2
+	if lookahead := ctx.Duration("lookahead"); lookahead > 0 {
+		return t1, now.Add(lookahead)
+	}
+
+	return t1, t1.Add(ctx.Duration("duration"))
+}
+
+// managedTags are the tags calwarrior adds and removes itself, which tag
+// mappings leave alone.
+func (ctx *cliContext) managedTags() []string {
+	tags := append([]string{}, ctx.StringSlice("tag")...)
+
+	for _, name := range []string{"tentative-tag", "quarantine-tag"} {
+		if tag := ctx.String(name); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+func (ctx *cliContext) makeLogger() (logger, error) {
+	return makeLogger(ctx.String("log-format"), os.Getenv("DEBUG") != "")
+}
+
+// runContext returns the context for a run, limited by --timeout.
+func (ctx *cliContext) runContext() (context.Context, context.CancelFunc) {
+	if timeout := ctx.Duration("timeout"); timeout > 0 {
+		return context.WithTimeout(ctx.Context.Context, timeout)
+	}
+
+	return context.WithCancel(ctx.Context.Context)
+}
+
+// connect finds taskwarrior and sets up the calendar client.
+func (ctx *cliContext) connect(runCtx context.Context, cfg *config, log logger) (*taskWarrior, *calendarClient, error) {
+	tc, err := ctx.taskwarrior(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tw, err := findTaskwarrior(tc)
+	if err != nil {
+		return nil, nil, taskwarriorFailure(err)
+	}
+
+	cal, err := getCalendarClient(runCtx, ctx.Duration("retry-budget"), log)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Trouble contacting google calendar: %w", err)
+	}
+
+	return tw, cal, nil
 }
 
 func (ctx *cliContext) run() error {
-	tw, err := findTaskwarrior()
+	log, err := ctx.makeLogger()
 	if err != nil {
 		return err
 	}
 
-	cal, err := getCalendarClient()
+	// validate the format before doing any work
+	if err := newSyncReport().write(ctx.String("report"), ioutil.Discard); err != nil {
+		return err
+	}
+
+	if declined := ctx.String("declined"); declined != "complete" && declined != "delete" {
+		return fmt.Errorf("Invalid --declined value %q: must be complete or delete", declined)
+	}
+
+	if _, err := ctx.outsideWindow(); err != nil {
+		return err
+	}
+
+	runCtx, cancel := ctx.runContext()
+	defer cancel()
+
+	lock, err := acquireSyncLock(runCtx, ctx.Bool("wait"), log)
 	if err != nil {
-		return fmt.Errorf("Trouble contacting google calendar: %w", err)
+		return err
 	}
+	defer lock.release()
 
-	m := newMerge(ctx, tw, cal)
-	if err := m.run(); err != nil {
-		m.log.Error(err)
+	cfg, err := ctx.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	dates, err := ctx.dates(cfg)
+	if err != nil {
+		return err
+	}
+
+	fields, err := newFieldMap(cfg, dates)
+	if err != nil {
+		return err
+	}
+	fields.manageTags(ctx.managedTags()...)
+
+	completion, err := ctx.completion(cfg)
+	if err != nil {
+		return err
+	}
+
+	events, err := newEventFilter(cfg)
+	if err != nil {
+		return err
+	}
+
+	tw, cal, err := ctx.connect(runCtx, cfg, log)
+	if err != nil {
+		return exitWith(err, nil)
+	}
+
+	if err := fields.resolveColors(runCtx, cal); err != nil {
+		return exitWith(err, nil)
+	}
+
+	if err := completion.resolveColor(runCtx, cal); err != nil {
+		return exitWith(err, nil)
+	}
+
+	filter, err := ctx.taskFilter(runCtx, cfg, tw)
+	if err != nil {
+		return exitWith(err, nil)
+	}
+
+	m := newMerge(ctx, tw, cal, log, fields, completion, filter, events)
+	runErr := m.run(runCtx)
+	if runErr != nil {
+		// item errors have already been logged and reported
+		var itemErrs syncErrors
+		if !errors.As(runErr, &itemErrs) {
+			m.log.Error(runErr)
+			m.report.addError(nil, nil, runErr)
+		}
+	}
+
+	m.report.finish()
+	if err := m.report.write(ctx.String("report"), os.Stdout); err != nil {
+		return err
 	}
 
-	return nil
+	return exitWith(runErr, m.report)
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// colorTaskField is the task attribute mapped to the event color: the color
+// configured for the task's priority, or failing that, its project.
+const colorTaskField = "color"
+
+// the names google calendar shows for the event color IDs.
+var eventColorNames = map[string]string{
+	"lavender":  "1",
+	"sage":      "2",
+	"grape":     "3",
+	"flamingo":  "4",
+	"banana":    "5",
+	"tangerine": "6",
+	"peacock":   "7",
+	"graphite":  "8",
+	"blueberry": "9",
+	"basil":     "10",
+	"tomato":    "11",
+}
+
+// colorConfig assigns event colors to priorities and projects. Colors may be
+// given by name (e.g. "tomato"), color ID, or background hex value.
+type colorConfig struct {
+	Priority map[string]string `json:"priority"`
+	Project  map[string]string `json:"project"`
+}
+
+// eventColors is colorConfig with the colors resolved to color IDs.
+type eventColors struct {
+	priority map[string]string
+	project  map[string]string
+}
+
+func (cc *colorConfig) configured() bool {
+	return cc != nil && (len(cc.Priority) > 0 || len(cc.Project) > 0)
+}
+
+// resolve validates the configured colors against the calendar's palette.
+func (cc *colorConfig) resolve(palette map[string]calendar.ColorDefinition) (*eventColors, error) {
+	ec := &eventColors{priority: map[string]string{}, project: map[string]string{}}
+
+	for _, m := range []struct {
+		from map[string]string
+		to   map[string]string
+	}{{cc.Priority, ec.priority}, {cc.Project, ec.project}} {
+		for key, color := range m.from {
+			id, err := resolveColor(color, palette)
+			if err != nil {
+				return nil, err
+			}
+			m.to[key] = id
+		}
+	}
+
+	return ec, nil
+}
+
+func resolveColor(color string, palette map[string]calendar.ColorDefinition) (string, error) {
+	color = strings.ToLower(strings.TrimSpace(color))
+
+	if id, ok := eventColorNames[color]; ok {
+		color = id
+	}
+
+	if _, ok := palette[color]; ok {
+		return color, nil
+	}
+
+	for id, def := range palette {
+		if strings.ToLower(def.Background) == color {
+			return id, nil
+		}
+	}
+
+	return "", fmt.Errorf("Unknown event color %q", color)
+}
+
+func (cal *calendarClient) eventColorPalette(ctx context.Context) (map[string]calendar.ColorDefinition, error) {
+	colors, err := cal.Colors.Get().Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Could not retrieve calendar colors: %w", err)
+	}
+
+	return colors.Event, nil
+}
+
+// projectColor looks up the color for the project or, for dotted
+// subprojects, the closest parent with one.
+func (ec *eventColors) projectColor(project string) string {
+	for project != "" {
+		if color, ok := ec.project[project]; ok {
+			return color
+		}
+
+		i := strings.LastIndex(project, ".")
+		if i < 0 {
+			break
+		}
+		project = project[:i]
+	}
+
+	return ""
+}
+
+func (ec *eventColors) taskColor(task *taskWarriorItem) string {
+	if color, ok := ec.priority[task.Priority]; ok && task.Priority != "" {
+		return color
+	}
+
+	return ec.projectColor(task.Project)
+}
+
+// setTaskColor writes a color chosen in the calendar back to the task's
+// priority, reporting whether the task changed. Choosing the project's color
+// clears the priority; other colors are left alone.
+func (ec *eventColors) setTaskColor(task *taskWarriorItem, color string) bool {
+	priority := task.Priority
+
+	for p, priorityColor := range ec.priority {
+		if priorityColor == color {
+			task.Priority = p
+			return task.Priority != priority
+		}
+	}
+
+	if color != "" && color == ec.projectColor(task.Project) {
+		task.Priority = ""
+	}
+
+	return task.Priority != priority
+}
+
+// resolveColors enables the color mappings, if colors are configured.
+func (fm *fieldMap) resolveColors(ctx context.Context, cal *calendarClient) error {
+	if !fm.colorConfig.configured() {
+		return nil
+	}
+
+	palette, err := cal.eventColorPalette(ctx)
+	if err != nil {
+		return calendarFailure(err)
+	}
+
+	fm.colors, err = fm.colorConfig.resolve(palette)
+	return err
+}
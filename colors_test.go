@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestUnifyUnmappedColor(t *testing.T) {
+	fm, err := newFieldMap(&config{Colors: &colorConfig{Priority: map[string]string{"H": "tomato"}}}, &datesConfig{Start: dateDue})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm.colors = &eventColors{priority: map[string]string{"H": "11"}, project: map[string]string{}}
+
+	task := &taskWarriorItem{
+		UUID:        "3f2504e0-4f89-11d3-9a0c-0305e82c3301",
+		Description: "Write report",
+		Priority:    "M",
+		Due:         "20210601T090000Z",
+		Modified:    "20210601T080000Z",
+		CalendarID:  "event",
+	}
+
+	start := &calendar.EventDateTime{DateTime: "2021-06-01T09:00:00Z"}
+	event := &calendar.Event{
+		Id:      "event",
+		Summary: "Write report",
+		Start:   start,
+		End:     start,
+		ColorId: "7", // not the color of any priority or project
+		Updated: "2021-06-01T10:00:00Z",
+	}
+
+	for run := 1; run <= 2; run++ {
+		modified, err := unify(fm, task, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if modified {
+			t.Fatalf("run %d: expected no change for an unmapped color", run)
+		}
+
+		if task.Priority != "M" || event.ColorId != "7" {
+			t.Fatalf("run %d: expected priority M and color 7, got %q and %q", run, task.Priority, event.ColorId)
+		}
+	}
+
+	event.ColorId = "11"
+
+	modified, err := unify(fm, task, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !modified || task.Priority != "H" {
+		t.Fatalf("expected the priority color to set priority H, got %q", task.Priority)
+	}
+
+	if modified, err := unify(fm, task, event); err != nil || modified {
+		t.Fatalf("expected no change once the priority is set, got %v, %v", modified, err)
+	}
+}
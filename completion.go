@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// completion policies
+const (
+	completeDelete = "delete"
+	completePrefix = "prefix"
+	completeColor  = "color"
+	completeMove   = "move"
+)
+
+// private extended properties recording how an event was marked completed,
+// so it can be reversed.
+const (
+	completedProperty     = "calwarriorCompleted"
+	originalColorProperty = "calwarriorColor"
+)
+
+// completionConfig decides what happens to an event when its task is
+// completed.
+type completionConfig struct {
+	Policy   string `json:"policy"`   // delete (default), prefix, color or move
+	Prefix   string `json:"prefix"`   // for prefix; default "✔ "
+	Color    string `json:"color"`    // for color; default graphite
+	Calendar string `json:"calendar"` // for move; the ID of the "Done" calendar
+}
+
+// completion returns the completion settings, with --on-complete overriding
+// the configured policy.
+func (ctx *cliContext) completion(cfg *config) (*completionConfig, error) {
+	cc := completionConfig{}
+	if cfg.Completion != nil {
+		cc = *cfg.Completion
+	}
+
+	if policy := ctx.String("on-complete"); policy != "" {
+		cc.Policy = policy
+	}
+
+	if cc.Policy == "" {
+		cc.Policy = completeDelete
+	}
+
+	if cc.Prefix == "" {
+		cc.Prefix = "✔ "
+	}
+
+	if cc.Color == "" {
+		cc.Color = "graphite"
+	}
+
+	switch cc.Policy {
+	case completeDelete, completePrefix, completeColor:
+	case completeMove:
+		if cc.Calendar == "" {
+			return nil, errors.New("The move completion policy requires a calendar to be configured")
+		}
+	default:
+		return nil, fmt.Errorf("Invalid completion policy %q: must be delete, prefix, color or move", cc.Policy)
+	}
+
+	return &cc, nil
+}
+
+// resolveColor validates the color used by the color policy.
+func (cc *completionConfig) resolveColor(ctx context.Context, cal *calendarClient) error {
+	if cc.Policy != completeColor {
+		return nil
+	}
+
+	palette, err := cal.eventColorPalette(ctx)
+	if err != nil {
+		return calendarFailure(err)
+	}
+
+	cc.Color, err = resolveColor(cc.Color, palette)
+	return err
+}
+
+func eventMarkedCompleted(event *calendar.Event) bool {
+	return event.ExtendedProperties != nil && event.ExtendedProperties.Private[completedProperty] != ""
+}
+
+// markCompleted changes the event to show its task is done. It reports false
+// if the event already is marked.
+func (cc *completionConfig) markCompleted(event *calendar.Event) bool {
+	if eventMarkedCompleted(event) {
+		return false
+	}
+
+	setEventField(event, privatePropertyPrefix+completedProperty, cc.Policy)
+
+	switch cc.Policy {
+	case completePrefix:
+		event.Summary = cc.Prefix + event.Summary
+	case completeColor:
+		setEventField(event, privatePropertyPrefix+originalColorProperty, event.ColorId)
+		event.ColorId = cc.Color
+	}
+
+	return true
+}
+
+// unmarkCompleted reverses markCompleted. It reports false if the event was
+// not marked.
+func (cc *completionConfig) unmarkCompleted(event *calendar.Event) bool {
+	if !eventMarkedCompleted(event) {
+		return false
+	}
+
+	props := event.ExtendedProperties.Private
+
+	switch props[completedProperty] {
+	case completePrefix:
+		event.Summary = strings.TrimPrefix(event.Summary, cc.Prefix)
+	case completeColor:
+		event.ColorId = props[originalColorProperty]
+		props[originalColorProperty] = ""
+	}
+
+	// an empty value, so the patch clears it
+	props[completedProperty] = ""
+	return true
+}
+
+// completeEvents applies the completion policy to the events of completed
+// tasks.
+func (m *merge) completeEvents() {
+	for _, task := range m.completedTasks {
+		task := task
+		event := m.eventsIDMap[task.CalendarID]
+
+		if m.completion.Policy == completeMove {
+			m.batch.move(event.Id, m.completion.Calendar, func(_ *calendar.Event, err error) {
+				if err != nil {
+					m.itemFailed(task, event, fmt.Errorf("Error moving completed event: %w", err))
+					return
+				}
+				m.report.count(func(r *syncReport) { r.Calendar.Updated++ })
+			})
+			continue
+		}
+
+		if !m.completion.markCompleted(event) {
+			continue
+		}
+
+		m.batch.modify(event, func(_ *calendar.Event, err error) {
+			if err != nil {
+				m.itemFailed(task, event, fmt.Errorf("Error marking event completed: %w", err))
+				return
+			}
+			m.report.count(func(r *syncReport) { r.Calendar.Updated++ })
+		})
+	}
+}
+
+// restoreMovedEvent moves the event of a task that was completed and then
+// reopened back from the "Done" calendar.
+func (m *merge) restoreMovedEvent(ctx context.Context, calID string, fetchErr error) (*calendar.Event, error) {
+	var gerr *googleapi.Error
+	if m.completion.Policy != completeMove || !errors.As(fetchErr, &gerr) || gerr.Code != http.StatusNotFound {
+		return nil, fetchErr
+	}
+
+	if _, err := m.cal.Events.Get(m.completion.Calendar, calID).Context(ctx).Do(); err != nil {
+		return nil, fetchErr
+	}
+
+	event, err := m.cal.Events.Move(m.completion.Calendar, calID, "primary").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Could not move event back from the completed calendar: %w", err)
+	}
+
+	m.log.Noticef("Moved event %q (%.20q) back from the completed calendar", event.Id, event.Summary)
+	return event, nil
+}
+
+func (b *calendarBatch) move(calID, destination string, done func(*calendar.Event, error)) {
+	b.ops = append(b.ops, &batchOp{
+		method: http.MethodPost,
+		path:   eventsPath("primary") + "/" + url.PathEscape(calID) + "/move?destination=" + url.QueryEscape(destination),
+		done:   done,
+	})
+}
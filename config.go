@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const configFile = "config.json"
+
+// config is read from config.json in the settings directory, or the file
+// given with --config.
+type config struct {
+	// Mappings declare which task attributes are synced with which event
+	// fields. They are applied on top of defaultMappings; a mapping replaces
+	// any default mapping for the same event field.
+	Mappings []fieldMapping `json:"mappings"`
+	// Transforms are named value maps (task value -> event value) usable in
+	// mappings.
+	Transforms map[string]map[string]string `json:"transforms"`
+	// Colors assigns event colors to task priorities and projects.
+	Colors *colorConfig `json:"colors"`
+	// Completion decides what happens to the event of a completed task.
+	Completion *completionConfig `json:"completion"`
+	// Taskwarrior selects the taskwarrior binary and task database.
+	Taskwarrior *taskwarriorConfig `json:"taskwarrior"`
+	// Filter is a taskwarrior filter selecting the tasks to sync, on top of
+	// the sync tags.
+	Filter string `json:"filter"`
+	// Events decides which new events are turned into tasks.
+	Events *eventFilterConfig `json:"events"`
+	// Dates decides which task date events are placed on.
+	Dates *datesConfig `json:"dates"`
+	// Plan sets the working hours `calwarrior plan` places tasks in.
+	Plan *planConfig `json:"plan"`
+}
+
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+
+	if path == "" {
+		dir, err := findSettingsDir()
+		if err != nil {
+			return nil, err
+		}
+
+		path = filepath.Join(dir, configFile)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Trouble reading configuration: %w", err)
+	}
+
+	if err := json.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("Trouble parsing configuration %q: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func (ctx *cliContext) loadConfig() (*config, error) {
+	return loadConfig(ctx.String("config"))
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// the task dates an event can start on
+const (
+	dateDue              = "due"
+	dateScheduled        = "scheduled"
+	dateScheduledElseDue = "scheduled-else-due"
+)
+
+// policies for tasks without the date their event starts on
+const (
+	undatedSkip    = "skip"
+	undatedToday   = "today"
+	undatedDate    = "date"
+	undatedTag     = "tag"
+	undatedSomeday = "someday"
+)
+
+// mark all-day marker events; the value is the task's UUID.
+const (
+	deadlineProperty = "calwarriorDeadline"
+	somedayProperty  = "calwarriorSomeday"
+)
+
+// datesConfig decides which task date events are placed on.
+type datesConfig struct {
+	Start       string `json:"start"`        // due (default), scheduled or scheduled-else-due
+	Deadlines   bool   `json:"deadlines"`    // mark due dates with all-day events
+	Undated     string `json:"undated"`      // skip (default), today, date, tag or someday
+	UndatedDate string `json:"undated_date"` // for date; a taskwarrior date such as "eow"
+	UndatedTag  string `json:"undated_tag"`  // for tag; default "undated"
+}
+
+// dates returns the date settings, with --event-date, --deadlines and
+// --undated overriding the configuration.
+func (ctx *cliContext) dates(cfg *config) (*datesConfig, error) {
+	dc := datesConfig{}
+	if cfg.Dates != nil {
+		dc = *cfg.Dates
+	}
+
+	if start := ctx.String("event-date"); start != "" {
+		dc.Start = start
+	}
+
+	if ctx.Bool("deadlines") {
+		dc.Deadlines = true
+	}
+
+	if undated := ctx.String("undated"); undated != "" {
+		dc.Undated = undated
+	}
+
+	if date := ctx.String("undated-date"); date != "" {
+		dc.UndatedDate = date
+	}
+
+	if dc.Start == "" {
+		dc.Start = dateDue
+	}
+
+	if dc.Undated == "" {
+		dc.Undated = undatedSkip
+	}
+
+	if dc.UndatedTag == "" {
+		dc.UndatedTag = "undated"
+	}
+
+	switch dc.Start {
+	case dateDue, dateScheduled, dateScheduledElseDue:
+	default:
+		return nil, fmt.Errorf("Invalid event date %q: must be due, scheduled or scheduled-else-due", dc.Start)
+	}
+
+	switch dc.Undated {
+	case undatedSkip, undatedToday, undatedTag, undatedSomeday:
+	case undatedDate:
+		if dc.UndatedDate == "" {
+			return nil, errors.New("The date undated policy requires a date to be configured")
+		}
+	default:
+		return nil, fmt.Errorf("Invalid undated policy %q: must be skip, today, date, tag or someday", dc.Undated)
+	}
+
+	return &dc, nil
+}
+
+// eventDate returns the task date its event starts on.
+func (fm *fieldMap) eventDate(task *taskWarriorItem) taskWarriorTime {
+	return taskWarriorTime(fm.taskField(task, fm.dates.Start))
+}
+
+// taskwarrior's calc command prints dates in local time, in this format.
+const twCalcFormat = "2006-01-02T15:04:05"
+
+// calcDate has taskwarrior evaluate a date expression such as "eow".
+func (tw *taskWarrior) calcDate(ctx context.Context, expr string) (time.Time, error) {
+	out, err := tw.readTask(ctx, "calc", expr)
+	if err != nil {
+		return time.Time{}, taskwarriorFailure(fmt.Errorf("Could not evaluate date %q: %w", expr, err))
+	}
+
+	t, err := time.ParseInLocation(twCalcFormat, strings.TrimSpace(string(out)), time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date: %w", expr, err)
+	}
+
+	return t, nil
+}
+
+// resolveUndatedDate sets the date given to tasks without one, for the today
+// and date policies.
+func (m *merge) resolveUndatedDate(ctx context.Context) error {
+	switch m.fields.dates.Undated {
+	case undatedToday:
+		now := time.Now()
+		m.undatedDate = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	case undatedDate:
+		date, err := m.tw.calcDate(ctx, m.fields.dates.UndatedDate)
+		if err != nil {
+			return err
+		}
+		m.undatedDate = date
+	}
+
+	return nil
+}
+
+// eventStart returns the start of a new event for the task. Tasks without a
+// date are handled by the undated policy; ok is false if no event should be
+// created.
+func (m *merge) eventStart(task *taskWarriorItem) (*calendar.EventDateTime, bool) {
+	if m.fields.eventDate(task) == "" {
+		// closed tasks never get an event; the policy is only for pending ones
+		if task.Status != "pending" {
+			return nil, false
+		}
+
+		switch m.fields.dates.Undated {
+		case undatedToday, undatedDate:
+			m.log.Noticef("Task %q (%.20q) has no %s date; scheduling it on %s", task.UUID, task.Description, m.fields.dates.Start, m.undatedDate.Format("2006-01-02"))
+			m.fields.setTaskField(task, m.fields.dates.Start, string(toTaskWarriorTime(m.undatedDate)))
+		case undatedSomeday:
+			// placed on the someday event by syncMarkers
+			return nil, false
+		case undatedTag:
+			tags := taskWarriorTags{m.fields.dates.UndatedTag}.addTo(task.Tags)
+			if len(tags) != len(task.Tags) {
+				m.log.Noticef("Task %q (%.20q) has no %s date; tagging it +%s", task.UUID, task.Description, m.fields.dates.Start, m.fields.dates.UndatedTag)
+				task.Tags = tags
+				m.updateTask(task)
+			}
+			m.report.addSkipped(task, fmt.Sprintf("no %s date; tagged +%s", m.fields.dates.Start, m.fields.dates.UndatedTag))
+			return nil, false
+		default:
+			m.log.Noticef("Skipping task %q (%.20q): no %s date", task.UUID, task.Description, m.fields.dates.Start)
+			m.report.addSkipped(task, fmt.Sprintf("no %s date", m.fields.dates.Start))
+			return nil, false
+		}
+	}
+
+	start, err := m.fields.eventDate(task).ToGCal()
+	if err != nil {
+		m.itemFailed(task, nil, fmt.Errorf("Could not convert %s time to gcal event time: %w", m.fields.dates.Start, err))
+		return nil, false
+	}
+
+	return start, true
+}
+
+// isMarker reports whether the event is an all-day marker kept for a task,
+// rather than the task's own event.
+func isMarker(event *calendar.Event) bool {
+	if event.ExtendedProperties == nil {
+		return false
+	}
+
+	props := event.ExtendedProperties.Private
+	return props[deadlineProperty] != "" || props[somedayProperty] != ""
+}
+
+// allDay returns the start and end of an all-day event on t's date.
+func allDay(t time.Time) (*calendar.EventDateTime, *calendar.EventDateTime) {
+	t = t.In(time.Local)
+	return &calendar.EventDateTime{Date: string(toCalendarDate(t))},
+		&calendar.EventDateTime{Date: string(toCalendarDate(t.AddDate(0, 0, 1)))}
+}
+
+// marker is an all-day event kept for a task besides its own event, such as
+// its deadline.
+type marker struct {
+	kind     string  // for messages
+	property string  // the private property identifying the event
+	suffix   string  // added to the task's event ID for the marker's
+	id       *string // the task's link to the event
+	summary  string
+	day      time.Time
+}
+
+// syncMarkers keeps the all-day markers of the tasks: deadlines on the due
+// date of tasks whose events start on another date, and someday events for
+// tasks without a date. Markers are removed when no longer needed.
+func (m *merge) syncMarkers(ctx context.Context, tasks taskWarriorItems) {
+	deadlines := m.fields.dates.Deadlines && m.fields.dates.Start != dateDue
+	someday := m.fields.dates.Undated == undatedSomeday
+
+	for _, task := range tasks {
+		if m.failedTasks[task] {
+			continue
+		}
+
+		pending := task.Status == "pending"
+
+		due, err := task.Due.ToTime()
+		m.syncMarker(ctx, task, marker{
+			kind:     "deadline",
+			property: deadlineProperty,
+			suffix:   "due",
+			id:       &task.DeadlineID,
+			summary:  "Due: " + task.Description,
+			day:      due,
+		}, deadlines && pending && err == nil)
+
+		m.syncMarker(ctx, task, marker{
+			kind:     "someday",
+			property: somedayProperty,
+			suffix:   "undated",
+			id:       &task.SomedayID,
+			summary:  task.Description,
+			day:      time.Now(),
+		}, someday && pending && m.fields.eventDate(task) == "")
+	}
+}
+
+// markerID derives the marker's event ID from the task, so a marker whose
+// link was never imported is not inserted a second time.
+func markerID(task *taskWarriorItem, mk marker) string {
+	return eventIDForTask(task) + mk.suffix
+}
+
+func (m *merge) syncMarker(ctx context.Context, task *taskWarriorItem, mk marker, needed bool) {
+	if *mk.id != "" && !needed {
+		m.batch.delete(*mk.id, func(err error) {
+			if err != nil && !isGone(err) {
+				m.itemFailed(task, nil, fmt.Errorf("Error deleting %s event: %w", mk.kind, err))
+				return
+			}
+			*mk.id = ""
+			m.updateTask(task)
+		})
+		return
+	}
+
+	if !needed {
+		return
+	}
+
+	start, end := allDay(mk.day)
+
+	if *mk.id != "" {
+		// markers outside the window are left as they are
+		event, ok := m.markerEvents[*mk.id]
+		if !ok || (event.Start != nil && event.Start.Date == start.Date && event.Summary == mk.summary) {
+			return
+		}
+
+		event.Summary = mk.summary
+		event.Start, event.End = start, end
+		m.batch.modify(event, func(_ *calendar.Event, err error) {
+			if err != nil {
+				m.itemFailed(task, event, fmt.Errorf("Error modifying %s event: %w", mk.kind, err))
+				return
+			}
+			m.report.count(func(r *syncReport) { r.Calendar.Updated++ })
+		})
+		return
+	}
+
+	event := &calendar.Event{
+		Id:           markerID(task, mk),
+		Summary:      mk.summary,
+		Start:        start,
+		End:          end,
+		Transparency: "transparent",
+		ExtendedProperties: &calendar.EventExtendedProperties{
+			Private: map[string]string{mk.property: task.UUID},
+		},
+	}
+
+	m.batch.insert(event, func(inserted *calendar.Event, err error) {
+		switch {
+		case isConflict(err):
+			// inserted by an earlier run which did not import the link, or
+			// deleted since: bring it up to date
+			m.log.Noticef("Relinking task %q (%.20q) to its %s event %q", task.UUID, task.Description, mk.kind, event.Id)
+			event.Status = "confirmed"
+			if inserted, err = m.cal.modifyEvent(ctx, event); err == nil {
+				m.report.count(func(r *syncReport) { r.Calendar.Updated++ })
+			}
+		case err == nil:
+			m.report.count(func(r *syncReport) { r.Calendar.Created++ })
+		}
+
+		if err != nil {
+			m.itemFailed(task, nil, fmt.Errorf("Error inserting %s event: %w", mk.kind, err))
+			return
+		}
+		*mk.id = inserted.Id
+		m.updateTask(task)
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// markerMerge returns a merge whose calendar answers patches of event id by
+// echoing them, recording the patched events.
+func markerMerge(t *testing.T, dates *datesConfig, id string, patched *[]*calendar.Event) *merge {
+	m := testMerge(t, &config{}, dates)
+
+	m.cal = newTestCalendarClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/calendars/primary/events/"+id {
+			http.Error(w, "unexpected request "+r.Method+" "+r.URL.Path, http.StatusBadRequest)
+			return
+		}
+
+		event := &calendar.Event{}
+		if err := json.NewDecoder(r.Body).Decode(event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*patched = append(*patched, event)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(event)
+	}))
+
+	return m
+}
+
+func TestSomedayMarkerID(t *testing.T) {
+	task := &taskWarriorItem{
+		UUID:        "3f2504e0-4f89-11d3-9a0c-0305e82c3301",
+		Status:      "pending",
+		Description: "Learn the cello",
+	}
+
+	id := eventIDForTask(task) + "undated"
+
+	patched := []*calendar.Event{}
+	m := markerMerge(t, &datesConfig{Start: dateDue, Undated: undatedSomeday}, id, &patched)
+
+	m.syncMarkers(context.Background(), taskWarriorItems{task})
+
+	if len(m.batch.ops) != 1 || m.batch.ops[0].event.Id != id {
+		t.Fatalf("expected the someday marker to be inserted as %q", id)
+	}
+
+	// inserted by an earlier run whose import failed
+	m.batch.ops[0].done(nil, &googleapi.Error{Code: http.StatusConflict})
+
+	if len(patched) != 1 || patched[0].Summary != "Learn the cello" || patched[0].Start.Date == "" {
+		t.Fatalf("expected the existing marker to be updated, got %+v", patched)
+	}
+
+	if task.SomedayID != id || len(m.errors) > 0 {
+		t.Fatalf("expected the task to be linked to %q, got %q (%v)", id, task.SomedayID, m.errors)
+	}
+}
+
+func TestMarkerIDs(t *testing.T) {
+	task := &taskWarriorItem{UUID: "3F2504E0-4F89-11D3-9A0C-0305E82C3301"}
+	valid := regexp.MustCompile(`^[a-v0-9]{5,}$`)
+
+	ids := map[string]bool{eventIDForTask(task): true, planEventID(task): true}
+	for _, suffix := range []string{"due", "undated"} {
+		id := markerID(task, marker{suffix: suffix})
+		if !valid.MatchString(id) || ids[id] {
+			t.Fatalf("%q is not a valid, distinct event ID", id)
+		}
+		ids[id] = true
+	}
+}
+
+func TestDeadlineMarkerID(t *testing.T) {
+	task := &taskWarriorItem{
+		UUID:        "3f2504e0-4f89-11d3-9a0c-0305e82c3301",
+		Status:      "pending",
+		Description: "Write report",
+		Scheduled:   "20210601T090000Z",
+		Due:         "20210604T170000Z",
+	}
+
+	id := eventIDForTask(task) + "due"
+
+	patched := []*calendar.Event{}
+	m := markerMerge(t, &datesConfig{Start: dateScheduled, Deadlines: true}, id, &patched)
+
+	// the first run inserted the marker, but could not import the link
+	for run := 1; run <= 2; run++ {
+		m.batch = &calendarBatch{}
+		m.syncMarkers(context.Background(), taskWarriorItems{task})
+
+		if len(m.batch.ops) != 1 {
+			t.Fatalf("run %d: expected one insert, got %d operations", run, len(m.batch.ops))
+		}
+
+		op := m.batch.ops[0]
+		if op.method != http.MethodPost || op.event.Id != id {
+			t.Fatalf("run %d: expected the marker to be inserted as %q, got %s %q", run, id, op.method, op.event.Id)
+		}
+
+		if run == 1 {
+			op.done(&calendar.Event{Id: id}, nil)
+			task.DeadlineID = "" // lost with the failed import
+		} else {
+			op.done(nil, &googleapi.Error{Code: http.StatusConflict})
+		}
+	}
+
+	if len(patched) != 1 || patched[0].Status != "confirmed" || patched[0].Summary != "Due: Write report" {
+		t.Fatalf("expected the existing marker to be updated, got %+v", patched)
+	}
+
+	if task.DeadlineID != id {
+		t.Fatalf("expected the task to be linked to %q, got %q", id, task.DeadlineID)
+	}
+
+	if len(m.errors) > 0 {
+		t.Fatal(m.errors)
+	}
+
+	if m.report.Calendar.Created != 1 || m.report.Calendar.Updated != 1 {
+		t.Fatalf("expected one created and one updated marker, got %+v", m.report.Calendar)
+	}
+}
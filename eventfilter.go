@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// eventFilterConfig decides which new events are turned into tasks. Events
+// already linked to a task are always synced.
+type eventFilterConfig struct {
+	Include         string   `json:"include"`          // only summaries matching this regexp
+	Exclude         string   `json:"exclude"`          // no summaries matching this regexp
+	SkipTransparent bool     `json:"skip_transparent"` // no events that do not block time
+	OrganizerOnly   bool     `json:"organizer_only"`   // only events we organize
+	MinDuration     string   `json:"min_duration"`     // e.g. 15m
+	SkipTypes       []string `json:"skip_types"`       // e.g. focusTime, outOfOffice, workingLocation
+}
+
+// eventFilter is the compiled form of eventFilterConfig.
+type eventFilter struct {
+	include, exclude *regexp.Regexp
+	skipTransparent  bool
+	organizerOnly    bool
+	minDuration      time.Duration
+	skipTypes        map[string]bool
+
+	types map[string]string // event ID -> event type; see loadTypes
+}
+
+func newEventFilter(cfg *config) (*eventFilter, error) {
+	ef := &eventFilter{skipTypes: map[string]bool{}, types: map[string]string{}}
+	if cfg.Events == nil {
+		return ef, nil
+	}
+
+	var err error
+	if cfg.Events.Include != "" {
+		if ef.include, err = regexp.Compile(cfg.Events.Include); err != nil {
+			return nil, fmt.Errorf("Invalid event include pattern: %w", err)
+		}
+	}
+
+	if cfg.Events.Exclude != "" {
+		if ef.exclude, err = regexp.Compile(cfg.Events.Exclude); err != nil {
+			return nil, fmt.Errorf("Invalid event exclude pattern: %w", err)
+		}
+	}
+
+	if cfg.Events.MinDuration != "" {
+		if ef.minDuration, err = time.ParseDuration(cfg.Events.MinDuration); err != nil {
+			return nil, fmt.Errorf("Invalid minimum event duration: %w", err)
+		}
+	}
+
+	ef.skipTransparent = cfg.Events.SkipTransparent
+	ef.organizerOnly = cfg.Events.OrganizerOnly
+
+	for _, t := range cfg.Events.SkipTypes {
+		ef.skipTypes[t] = true
+	}
+
+	return ef, nil
+}
+
+// eventDuration returns how long the event lasts, or 0 if unknown.
+func eventDuration(event *calendar.Event) time.Duration {
+	if event.End == nil {
+		return 0
+	}
+
+	start, err := eventDue(event)
+	if err != nil {
+		return 0
+	}
+
+	end, err := eventDue(&calendar.Event{Start: event.End})
+	if err != nil {
+		return 0
+	}
+
+	t1, err1 := start.ToTime()
+	t2, err2 := end.ToTime()
+	if err1 != nil || err2 != nil {
+		return 0
+	}
+
+	return t2.Sub(t1)
+}
+
+// skip returns why the event should not become a task, or "" if it should.
+func (ef *eventFilter) skip(event *calendar.Event) string {
+	switch {
+	case ef.include != nil && !ef.include.MatchString(event.Summary):
+		return "summary not included"
+	case ef.exclude != nil && ef.exclude.MatchString(event.Summary):
+		return "summary excluded"
+	case ef.skipTransparent && event.Transparency == "transparent":
+		return "transparent"
+	case ef.organizerOnly && event.Organizer != nil && !event.Organizer.Self:
+		return "organized by " + event.Organizer.Email
+	case ef.minDuration > 0 && eventDuration(event) < ef.minDuration:
+		return "too short"
+	case ef.skipTypes[ef.types[event.Id]]:
+		return "event type " + ef.types[event.Id]
+	}
+
+	return ""
+}
+
+// loadTypes looks up the types of the events in the window when types are to
+// be skipped. The calendar library predates event types, so they are read
+// from the API directly.
+func (ef *eventFilter) loadTypes(ctx context.Context, cal *calendarClient, t1, t2 time.Time) error {
+	if len(ef.skipTypes) == 0 {
+		return nil
+	}
+
+	query := url.Values{
+		"timeMin":      {string(toCalendarTime(t1))},
+		"timeMax":      {string(toCalendarTime(t2))},
+		"singleEvents": {"true"},
+		"fields":       {"items(id,eventType),nextPageToken"},
+	}
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, cal.BasePath+eventsPath("primary")+"?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := cal.client.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if err := googleapi.CheckResponse(resp); err != nil {
+			resp.Body.Close()
+			return err
+		}
+
+		page := struct {
+			Items []struct {
+				ID        string `json:"id"`
+				EventType string `json:"eventType"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}{}
+
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("Could not parse event types: %w", err)
+		}
+
+		for _, item := range page.Items {
+			ef.types[item.ID] = item.EventType
+		}
+
+		if page.NextPageToken == "" {
+			return nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// exit codes; these are documented in the README.
+const (
+	exitSuccess     = 0
+	exitError       = 1 // usage and other errors
+	exitPartial     = 2 // some items failed to sync
+	exitAuth        = 3
+	exitTaskwarrior = 4
+	exitCalendar    = 5
+	exitConflicts   = 6 // sync completed, but conflicts need attention
+)
+
+// failure associates an error with the exit code it should produce.
+type failure struct {
+	code int
+	err  error
+}
+
+func (f *failure) Error() string {
+	return f.err.Error()
+}
+
+func (f *failure) Unwrap() error {
+	return f.err
+}
+
+func authFailure(err error) error {
+	return &failure{code: exitAuth, err: err}
+}
+
+func taskwarriorFailure(err error) error {
+	return &failure{code: exitTaskwarrior, err: err}
+}
+
+func calendarFailure(err error) error {
+	return &failure{code: exitCalendar, err: err}
+}
+
+func isAuthError(err error) bool {
+	var (
+		gerr *googleapi.Error
+		rerr *oauth2.RetrieveError
+	)
+
+	if errors.As(err, &gerr) && gerr.Code == http.StatusUnauthorized {
+		return true
+	}
+
+	return errors.As(err, &rerr)
+}
+
+// exitCode determines the exit code for the result of a sync run.
+func exitCode(err error, report *syncReport) int {
+	if err == nil {
+		if report != nil && len(report.Conflicts) > 0 {
+			return exitConflicts
+		}
+
+		return exitSuccess
+	}
+
+	if isAuthError(err) {
+		return exitAuth
+	}
+
+	var items syncErrors
+	if errors.As(err, &items) {
+		for _, item := range items {
+			if isAuthError(item) {
+				return exitAuth
+			}
+		}
+
+		return exitPartial
+	}
+
+	var f *failure
+	if errors.As(err, &f) {
+		return f.code
+	}
+
+	return exitError
+}
+
+// exitWith wraps err so the cli exits with the appropriate code.
+func exitWith(err error, report *syncReport) error {
+	code := exitCode(err, report)
+	if code == exitSuccess {
+		return nil
+	}
+
+	var msg interface{} = ""
+	if err != nil {
+		msg = err
+	}
+
+	return cli.Exit(msg, code)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+func TestExitCode(t *testing.T) {
+	conflicts := newSyncReport()
+	conflicts.addConflict(&taskWarriorItem{UUID: "uuid"}, nil, "conflict")
+
+	unauthorized := &googleapi.Error{Code: http.StatusUnauthorized}
+
+	table := []struct {
+		name   string
+		err    error
+		report *syncReport
+		code   int
+	}{
+		{"success", nil, newSyncReport(), exitSuccess},
+		{"success without report", nil, nil, exitSuccess},
+		{"conflicts only", nil, conflicts, exitConflicts},
+		{"auth 401", fmt.Errorf("Trouble gathering events: %w", unauthorized), newSyncReport(), exitAuth},
+		{"auth 401 as calendar failure", calendarFailure(unauthorized), newSyncReport(), exitAuth},
+		{"token refresh", &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusBadRequest}}, newSyncReport(), exitAuth},
+		{"auth failure", authFailure(errors.New("no token")), newSyncReport(), exitAuth},
+		{"partial", syncErrors{errors.New("one"), errors.New("two")}, newSyncReport(), exitPartial},
+		{"partial with auth", syncErrors{errors.New("one"), unauthorized}, newSyncReport(), exitAuth},
+		{"partial beats conflicts", syncErrors{errors.New("one")}, conflicts, exitPartial},
+		{"taskwarrior", taskwarriorFailure(errors.New("exit status 2")), newSyncReport(), exitTaskwarrior},
+		{"calendar", calendarFailure(&googleapi.Error{Code: http.StatusInternalServerError}), newSyncReport(), exitCalendar},
+		{"wrapped calendar", fmt.Errorf("sync: %w", calendarFailure(errors.New("down"))), newSyncReport(), exitCalendar},
+		{"other", errors.New("usage"), newSyncReport(), exitError},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			if code := exitCode(test.err, test.report); code != test.code {
+				t.Fatalf("expected exit code %d, got %d", test.code, code)
+			}
+
+			err := exitWith(test.err, test.report)
+			if test.code == exitSuccess {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var coder cli.ExitCoder
+			if !errors.As(err, &coder) || coder.ExitCode() != test.code {
+				t.Fatalf("expected cli exit with code %d, got %v", test.code, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// getTaskSetting reads a taskwarrior setting, empty if it is not set.
+func (tw *taskWarrior) getTaskSetting(ctx context.Context, name string) (string, error) {
+	out, err := tw.readTask(ctx, "_get", "rc."+name)
+	if err != nil {
+		return "", taskwarriorFailure(fmt.Errorf("Could not read setting %q: %w", name, err))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// contextFilter returns the read filter of the active taskwarrior context.
+func (tw *taskWarrior) contextFilter(ctx context.Context) (string, error) {
+	name, err := tw.getTaskSetting(ctx, "context")
+	if err != nil || name == "" || name == "none" {
+		return "", err
+	}
+
+	// taskwarrior 2.6 separates read and write filters
+	filter, err := tw.getTaskSetting(ctx, "context."+name+".read")
+	if err != nil || filter != "" {
+		return filter, err
+	}
+
+	return tw.getTaskSetting(ctx, "context."+name)
+}
+
+// taskFilter returns the filter arguments selecting the tasks to sync, on top
+// of the sync tags: --filter (or the configured filter) and, unless
+// --ignore-context is given, the active taskwarrior context.
+func (ctx *cliContext) taskFilter(runCtx context.Context, cfg *config, tw *taskWarrior) ([]string, error) {
+	filters := []string{}
+
+	filter := cfg.Filter
+	if f := ctx.String("filter"); f != "" {
+		filter = f
+	}
+
+	if filter != "" {
+		filters = append(filters, "("+filter+")")
+	}
+
+	if !ctx.Bool("ignore-context") {
+		filter, err := tw.contextFilter(runCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		if filter != "" {
+			filters = append(filters, "("+filter+")")
+		}
+	}
+
+	return filters, nil
+}
+
+// ignoreFiltered keeps events linked to tasks outside the filter from being
+// treated as new events.
+func (m *merge) ignoreFiltered(ctx context.Context, tags taskWarriorTags, tasks taskWarriorItems) error {
+	if len(m.filter) == 0 {
+		return nil
+	}
+
+	all, err := m.tw.exportTasksByCommand(ctx, append([]string{"export"}, tags.decorate()...)...)
+	if err != nil {
+		return err
+	}
+
+	selected := map[string]bool{}
+	for _, task := range tasks {
+		selected[task.UUID] = true
+	}
+
+	for _, task := range all {
+		if !selected[task.UUID] && task.CalendarID != "" {
+			m.ignoredEvents[task.CalendarID] = true
+		}
+	}
+
+	return nil
+}
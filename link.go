@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// taskUUIDProperty is the private extended property recording which task an
+// event was created for.
+const taskUUIDProperty = "calwarriorTask"
+
+// eventIDForTask derives the calendar ID for a task's event. Event IDs may
+// only use the characters a-v and 0-9, which a UUID without dashes satisfies.
+func eventIDForTask(task *taskWarriorItem) string {
+	return strings.ToLower(strings.Replace(task.UUID, "-", "", -1))
+}
+
+// eventTaskUUID returns the UUID of the task the event was created for, if
+// any.
+func eventTaskUUID(event *calendar.Event) string {
+	if event.ExtendedProperties == nil {
+		return ""
+	}
+
+	return event.ExtendedProperties.Private[taskUUIDProperty]
+}
+
+func setEventTaskUUID(event *calendar.Event, task *taskWarriorItem) {
+	if event.ExtendedProperties == nil {
+		event.ExtendedProperties = &calendar.EventExtendedProperties{}
+	}
+
+	if event.ExtendedProperties.Private == nil {
+		event.ExtendedProperties.Private = map[string]string{}
+	}
+
+	event.ExtendedProperties.Private[taskUUIDProperty] = task.UUID
+}
+
+// relinkEvents finds gathered events which were created for unsynced tasks
+// by an earlier run that did not get to record the link, and links them again
+// instead of creating duplicates. Such events outside the time window are
+// recovered when inserting the task's event runs into its ID; see
+// recoverExistingEvent.
+func (m *merge) relinkEvents() {
+	found := map[string]*calendar.Event{} // task UUID -> event
+
+	for _, event := range m.eventsIDMap {
+		if uuid := eventTaskUUID(event); uuid != "" {
+			found[uuid] = event
+		}
+	}
+
+	unsynced := taskWarriorItems{}
+
+	for _, task := range m.unsyncedTasks {
+		event, ok := found[task.UUID]
+		if !ok || m.failedTasks[task] {
+			unsynced = append(unsynced, task)
+			continue
+		}
+
+		m.log.Noticef("Relinking task %q (%.20q) to existing event %q", task.UUID, task.Description, event.Id)
+		m.eventsIDMap[event.Id] = event
+		m.taskIDMap[event.Id] = task
+		task.CalendarID = event.Id
+		m.updateTask(task)
+	}
+
+	m.unsyncedTasks = unsynced
+}
+
+// isConflict reports whether err is google's response to inserting an event
+// with an ID that is already taken.
+func isConflict(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusConflict
+}
+
+// isGone reports whether err means the event does not exist (anymore).
+func isGone(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && (gerr.Code == http.StatusNotFound || gerr.Code == http.StatusGone)
+}
+
+// recoverExistingEvent handles an insert that failed because the task's event
+// ID is already taken, which happens when an earlier insert succeeded but the
+// link was never recorded, or the event was deleted. The existing event is
+// returned, restored if it was deleted.
+func (m *merge) recoverExistingEvent(ctx context.Context, task *taskWarriorItem, insertErr error) (*calendar.Event, error) {
+	if !isConflict(insertErr) {
+		return nil, insertErr
+	}
+
+	event, err := m.cal.getEvent(ctx, eventIDForTask(task))
+	if err != nil {
+		return nil, fmt.Errorf("Event ID exists but could not be retrieved: %w", err)
+	}
+
+	if event.Status == "cancelled" {
+		m.log.Noticef("Restoring deleted event %q for task %q (%.20q)", event.Id, task.UUID, task.Description)
+		event.Status = "confirmed"
+		return m.cal.modifyEvent(ctx, event)
+	}
+
+	m.log.Noticef("Relinking task %q (%.20q) to existing event %q", task.UUID, task.Description, event.Id)
+	return event, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	lockFile         = "sync.lock"
+	lockPollInterval = time.Second
+)
+
+// syncLock is an advisory lock held for the duration of a sync, so that two
+// runs do not create events for the same tasks.
+type syncLock struct {
+	file *os.File
+}
+
+// acquireSyncLock takes the sync lock in the settings directory. If another
+// sync holds it, it either fails or, if wait is set, waits until the lock is
+// released or ctx is canceled.
+func acquireSyncLock(ctx context.Context, wait bool, log logger) (*syncLock, error) {
+	dir, err := findSettingsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, lockFile)
+	warned := false
+
+	for {
+		lock, pid, err := tryLock(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if lock != nil {
+			return lock, nil
+		}
+
+		// the lock is released when its holder dies, so it is still held even
+		// if the recorded pid is gone: the descriptor may have been inherited
+		// by a child, or the holder runs in another pid namespace. Removing the
+		// file would let two syncs run at once.
+		if pid > 0 && !warned && !processAlive(pid) {
+			log.Warnf("The sync lock %q is held, but pid %d which took it is not running here; it may have been inherited by a child, or taken in another pid namespace", path, pid)
+			warned = true
+		}
+
+		if !wait {
+			if pid > 0 {
+				return nil, fmt.Errorf("Another sync is already running (pid %d); use --wait to wait for it", pid)
+			}
+			return nil, errors.New("Another sync is already running; use --wait to wait for it")
+		}
+
+		log.Debugf("Waiting for sync running as pid %d", pid)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Gave up waiting for the sync lock: %w", ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// tryLock attempts to lock the file at path without blocking. If the lock is
+// held elsewhere, the pid recorded in the file is returned instead.
+func tryLock(path string) (*syncLock, int, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Could not open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		defer f.Close()
+
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, 0, fmt.Errorf("Could not lock %q: %w", path, err)
+		}
+
+		content, _ := ioutil.ReadAll(f)
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(content)))
+		return nil, pid, nil
+	}
+
+	// the file may have been removed between opening and locking it; if so,
+	// the lock is on an orphaned file and we need to try again.
+	locked, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	current, err := os.Stat(path)
+	if err != nil || !os.SameFile(locked, current) {
+		f.Close()
+		return tryLock(path)
+	}
+
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	return &syncLock{file: f}, 0, nil
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func (l *syncLock) release() error {
+	l.file.Truncate(0)
+	defer l.file.Close()
+
+	return syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// TestLockHolder is not a test by itself: it is run by the tests below in a
+// separate process, to hold the sync lock until its stdin is closed.
+func TestLockHolder(t *testing.T) {
+	if os.Getenv("CALWARRIOR_LOCK_HOLDER") == "" {
+		t.Skip("only run as a helper process")
+	}
+
+	lock, err := acquireSyncLock(context.Background(), false, logLevel(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Stdout.WriteString("locked\n")
+	ioutil.ReadAll(os.Stdin)
+	lock.release()
+}
+
+// holdLock starts a process holding the sync lock. Closing the returned
+// writer makes it release the lock and exit.
+func holdLock(t *testing.T) (*exec.Cmd, func()) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHolder$")
+	cmd.Env = append(os.Environ(), "CALWARRIOR_LOCK_HOLDER=1")
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || line != "locked\n" {
+		cmd.Process.Kill()
+		t.Fatalf("lock holder did not take the lock: %q %v", line, err)
+	}
+
+	return cmd, func() {
+		stdin.Close()
+		cmd.Wait()
+	}
+}
+
+func withSettingsDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "calwarrior")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	t.Cleanup(func() {
+		os.Setenv("XDG_CONFIG_HOME", old)
+		os.RemoveAll(dir)
+	})
+
+	return filepath.Join(dir, "calwarrior")
+}
+
+func TestSyncLockExcludesSecondSync(t *testing.T) {
+	withSettingsDir(t)
+
+	holder, release := holdLock(t)
+	defer release()
+
+	_, err := acquireSyncLock(context.Background(), false, logLevel(false))
+	if err == nil {
+		t.Fatal("expected the second sync to fail while the lock is held")
+	}
+
+	if !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+
+	if _, err := acquireSyncLock(ctx, true, logLevel(false)); err == nil {
+		t.Fatalf("expected waiting to time out while pid %d holds the lock", holder.Process.Pid)
+	}
+}
+
+// TestSecondSyncFails runs the commands taking the sync lock while another
+// sync holds it: they must stop before touching taskwarrior or the calendar.
+func TestSecondSyncFails(t *testing.T) {
+	withSettingsDir(t)
+
+	// exit codes would end the test binary
+	exited := -1
+	exiter := cli.OsExiter
+	cli.OsExiter = func(code int) { exited = code }
+	defer func() { cli.OsExiter = exiter }()
+
+	holder, release := holdLock(t)
+
+	// reaching taskwarrior fails with its own exit code
+	global := []string{"calwarrior", "--task-binary", "/nonexistent/task"}
+
+	table := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"sync", nil, "Another sync is already running"},
+		{"plan", []string{"plan"}, "Another sync is already running"},
+		{"link", []string{"link", "3f2504e0-4f89-11d3-9a0c-0305e82c3301", "event"}, "Another sync is already running"},
+		{"waiting sync", []string{"--wait", "--timeout", "1500ms"}, "Gave up waiting for the sync lock"},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			exited = -1
+
+			err := newApp().RunContext(context.Background(), append(append([]string{}, global...), test.args...))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("expected %q while pid %d holds the lock, got %v", test.want, holder.Process.Pid, err)
+			}
+
+			if exited != -1 {
+				t.Fatalf("expected a plain error, got exit code %d", exited)
+			}
+		})
+	}
+
+	release()
+
+	exited = -1
+	if err := newApp().RunContext(context.Background(), global); err == nil || exited != exitTaskwarrior {
+		t.Fatalf("expected the sync to get past the released lock to taskwarrior, got %v (exit code %d)", err, exited)
+	}
+}
+
+func TestSyncLockWaits(t *testing.T) {
+	withSettingsDir(t)
+
+	_, release := holdLock(t)
+	time.AfterFunc(500*time.Millisecond, release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lock, err := acquireSyncLock(ctx, true, logLevel(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.release()
+}
+
+func TestSyncLockKeepsHeldLockOfDeadPid(t *testing.T) {
+	dir := withSettingsDir(t)
+
+	_, release := holdLock(t)
+	defer release()
+
+	// as seen from another pid namespace: the holder's pid is not running here
+	path := filepath.Join(dir, lockFile)
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("999999999\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := acquireSyncLock(context.Background(), false, logLevel(false)); err == nil {
+		t.Fatal("expected the lock to stay held")
+	}
+
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !os.SameFile(before, after) {
+		t.Fatal("the held lock file was replaced")
+	}
+}
+
+func TestSyncLockStalePid(t *testing.T) {
+	dir := withSettingsDir(t)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// left behind by a sync which died; the lock itself is not held
+	if err := ioutil.WriteFile(filepath.Join(dir, lockFile), []byte("999999999\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := acquireSyncLock(context.Background(), false, logLevel(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.release()
+}
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/fatih/color"
 	"google.golang.org/api/calendar/v3"
@@ -17,13 +22,27 @@ type logger interface {
 	DeleteTask(*taskWarriorItem)
 	DeleteEvent(*calendar.Event)
 	Error(error)
+	ItemError(*taskWarriorItem, *calendar.Event, error)
 	Noticef(string, ...interface{})
 	Warnf(string, ...interface{})
 	Debugf(string, ...interface{})
 }
 
+func makeLogger(format string, debug bool) (logger, error) {
+	switch format {
+	case "", "text":
+		return logLevel(debug), nil
+	case "json":
+		return &jsonLogger{debug: debug, out: os.Stderr}, nil
+	default:
+		return nil, fmt.Errorf("Invalid log format %q: must be text or json", format)
+	}
+}
+
+// printfln writes a log line. Logs go to stderr, keeping stdout for the
+// report.
 func printfln(s string, args ...interface{}) {
-	fmt.Printf(s+"\n", args...)
+	fmt.Fprintf(os.Stderr, s+"\n", args...)
 }
 
 func (l logLevel) Debugf(s string, args ...interface{}) {
@@ -44,6 +63,10 @@ func (l logLevel) Error(err error) {
 	printfln(color.RedString("%v"), err)
 }
 
+func (l logLevel) ItemError(task *taskWarriorItem, event *calendar.Event, err error) {
+	l.Error(err)
+}
+
 func (l logLevel) AddTask(task *taskWarriorItem) {
 	printfln(color.BlueString("Creating new task for %q"), task.Description)
 }
@@ -67,3 +90,88 @@ func (l logLevel) DeleteTask(task *taskWarriorItem) {
 func (l logLevel) DeleteEvent(event *calendar.Event) {
 	printfln(color.HiMagentaString("Deleting event %q (%.20q)"), event.Id, event.Summary)
 }
+
+// jsonLogger writes one JSON object per line, suitable for log pipelines.
+type jsonLogger struct {
+	debug bool
+	out   io.Writer
+	mutex sync.Mutex
+}
+
+type jsonLogEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"msg"`
+	Task    string    `json:"task,omitempty"`
+	Event   string    `json:"event,omitempty"`
+	Summary string    `json:"summary,omitempty"`
+}
+
+func (l *jsonLogger) write(entry jsonLogEntry) {
+	entry.Time = time.Now().UTC()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	json.NewEncoder(l.out).Encode(entry)
+}
+
+func (l *jsonLogger) Debugf(s string, args ...interface{}) {
+	if l.debug {
+		l.write(jsonLogEntry{Level: "debug", Message: fmt.Sprintf(s, args...)})
+	}
+}
+
+func (l *jsonLogger) Noticef(s string, args ...interface{}) {
+	l.write(jsonLogEntry{Level: "notice", Message: fmt.Sprintf(s, args...)})
+}
+
+func (l *jsonLogger) Warnf(s string, args ...interface{}) {
+	l.write(jsonLogEntry{Level: "warn", Message: fmt.Sprintf(s, args...)})
+}
+
+func (l *jsonLogger) Error(err error) {
+	l.write(jsonLogEntry{Level: "error", Message: err.Error()})
+}
+
+// ItemError logs an error syncing the task and/or event, identifying both.
+func (l *jsonLogger) ItemError(task *taskWarriorItem, event *calendar.Event, err error) {
+	entry := jsonLogEntry{Level: "error", Message: err.Error()}
+
+	if task != nil {
+		entry.Task = task.UUID
+		entry.Event = task.CalendarID
+		entry.Summary = task.Description
+	}
+
+	if event != nil {
+		entry.Event = event.Id
+		entry.Summary = event.Summary
+	}
+
+	l.write(entry)
+}
+
+func (l *jsonLogger) AddTask(task *taskWarriorItem) {
+	l.write(jsonLogEntry{Level: "info", Message: "Creating new task", Task: task.UUID, Event: task.CalendarID, Summary: task.Description})
+}
+
+func (l *jsonLogger) AddEvent(event *calendar.Event) {
+	l.write(jsonLogEntry{Level: "info", Message: "Creating new calendar event", Event: event.Id, Summary: event.Summary})
+}
+
+func (l *jsonLogger) SyncTask(event *calendar.Event) {
+	l.write(jsonLogEntry{Level: "info", Message: "Syncing event to taskwarrior", Event: event.Id, Summary: event.Summary})
+}
+
+func (l *jsonLogger) SyncEvent(task *taskWarriorItem) {
+	l.write(jsonLogEntry{Level: "info", Message: "Pushing task to gcal", Task: task.UUID, Event: task.CalendarID, Summary: task.Description})
+}
+
+func (l *jsonLogger) DeleteTask(task *taskWarriorItem) {
+	l.write(jsonLogEntry{Level: "info", Message: "Deleting task", Task: task.UUID, Event: task.CalendarID, Summary: task.Description})
+}
+
+func (l *jsonLogger) DeleteEvent(event *calendar.Event) {
+	l.write(jsonLogEntry{Level: "info", Message: "Deleting event", Event: event.Id, Summary: event.Summary})
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/fatih/color"
@@ -11,18 +14,51 @@ import (
 )
 
 func main() {
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if err := newApp().RunContext(ctx, os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func newApp() *cli.App {
 	app := cli.NewApp()
 	app.Authors = []*cli.Author{{Name: "Erik Hollensbe", Email: "erik+github@hollensbe.org"}}
 	app.Usage = "Synchronize Google Calendar and Taskwarrior"
 	app.UsageText = filepath.Base(os.Args[0]) + " [--flags or help]"
 
 	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Usage:   "Configuration file (default: config.json in the settings directory)",
+			EnvVars: []string{"CALWARRIOR_CONFIG"},
+		},
 		&cli.DurationFlag{
 			Name:    "duration",
 			Aliases: []string{"d"},
 			Usage:   "Upcoming items to monitor in google calendar. Keeping this small and polling frequently is better",
 			Value:   7 * 24 * time.Hour,
 		},
+		&cli.DurationFlag{
+			Name:  "lookback",
+			Usage: "How far back to look for events",
+			Value: 24 * time.Hour,
+		},
+		&cli.DurationFlag{
+			Name:  "lookahead",
+			Usage: "How far ahead to look for events; overrides --duration, which is measured from the start of the lookback",
+		},
+		&cli.StringFlag{
+			Name:  "outside-window",
+			Usage: "What to do with linked pending tasks whose events are outside the time window: fetch them one by one, or freeze them until they are back",
+			Value: outsideFetch,
+		},
+		&cli.BoolFlag{
+			Name:  "full",
+			Usage: "Reconcile every linked task regardless of the time window, including deleting the events of closed tasks",
+		},
 		&cli.StringSliceFlag{
 			Name:    "tag",
 			Aliases: []string{"t"},
@@ -36,14 +72,154 @@ func main() {
 			EnvVars: []string{"CALWARRIOR_COLOR"},
 			Value:   false,
 		},
+		&cli.StringFlag{
+			Name:    "log-format",
+			Usage:   "Format of log output: text or json",
+			EnvVars: []string{"CALWARRIOR_LOG_FORMAT"},
+			Value:   "text",
+		},
+		&cli.DurationFlag{
+			Name:  "retry-budget",
+			Usage: "Total time to spend retrying rate limited or failed google calendar requests (0 disables retries)",
+			Value: 2 * time.Minute,
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "Abort the sync if it takes longer than this (0 for no limit)",
+			Value: 0,
+		},
+		&cli.BoolFlag{
+			Name:  "wait",
+			Usage: "Wait for another running sync to finish instead of exiting",
+			Value: false,
+		},
+		&cli.IntFlag{
+			Name:  "concurrency",
+			Usage: "Number of calendar events to fetch at once",
+			Value: 8,
+		},
+		&cli.BoolFlag{
+			Name:  "no-adopt",
+			Usage: "Always create new events for unsynced tasks, even if a matching event exists",
+			Value: false,
+		},
+		&cli.DurationFlag{
+			Name:  "adopt-tolerance",
+			Usage: "How far apart a task's due date and an existing event's start may be for the event to be adopted",
+			Value: 5 * time.Minute,
+		},
+		&cli.StringFlag{
+			Name:  "time-log-calendar",
+			Usage: "Record the time worked on tasks (between start and stop) as events on the calendar with this ID",
+		},
+		&cli.StringFlag{
+			Name:  "task-binary",
+			Usage: "The taskwarrior binary to run (default: task or taskw from $PATH)",
+		},
+		&cli.StringFlag{
+			Name:    "taskrc",
+			Usage:   "The taskwarrior configuration file to use",
+			EnvVars: []string{"TASKRC"},
+		},
+		&cli.StringFlag{
+			Name:    "taskdata",
+			Usage:   "The taskwarrior data directory to use",
+			EnvVars: []string{"TASKDATA"},
+		},
+		&cli.StringSliceFlag{
+			Name:  "task-rc",
+			Usage: "A taskwarrior setting to override, as name=value (e.g. --task-rc weekstart=monday); may be repeated",
+		},
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: "A taskwarrior filter selecting the tasks to sync, besides the tags (e.g. 'project:work and -someday')",
+		},
+		&cli.BoolFlag{
+			Name:  "ignore-context",
+			Usage: "Do not apply the active taskwarrior context to the tasks synced",
+		},
+		&cli.StringFlag{
+			Name:  "event-date",
+			Usage: "The task date events start on: due, scheduled or scheduled-else-due",
+		},
+		&cli.BoolFlag{
+			Name:  "deadlines",
+			Usage: "Also mark due dates with all-day events, when events start on the scheduled date",
+		},
+		&cli.StringFlag{
+			Name:  "undated",
+			Usage: "What to do with tasks without a date to place their event on: skip, today, date, tag or someday",
+		},
+		&cli.StringFlag{
+			Name:  "undated-date",
+			Usage: "The date given to tasks without one with --undated date, as a taskwarrior date (e.g. eow)",
+		},
+		&cli.StringFlag{
+			Name:  "on-complete",
+			Usage: "What to do with the event of a completed task: delete, prefix, color or move (overrides the configuration)",
+		},
+		&cli.StringFlag{
+			Name:  "declined",
+			Usage: "What to do with the task when its event is declined: complete or delete",
+			Value: "complete",
+		},
+		&cli.StringFlag{
+			Name:  "tentative-tag",
+			Usage: "Tag tasks for events we tentatively accepted with this tag (empty to disable)",
+			Value: "tentative",
+		},
+		&cli.IntFlag{
+			Name:  "quarantine",
+			Usage: "Tag tasks that fail to sync this many runs in a row so they are skipped (0 disables)",
+			Value: 0,
+		},
+		&cli.StringFlag{
+			Name:  "quarantine-tag",
+			Usage: "Tag used for quarantined tasks. Remove it from a task to try syncing it again",
+			Value: "calwarrior_quarantine",
+		},
+		&cli.StringFlag{
+			Name:  "report",
+			Usage: "Print a summary of the sync in the given format (json) when finished",
+		},
 	}
 
 	app.Action = run
-
-	if err := app.Run(os.Args); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	app.Commands = []*cli.Command{
+		{
+			Name:      "link",
+			Usage:     "Link a task to an existing event, or list ambiguous matches from the last sync",
+			ArgsUsage: "[task-uuid event-id]",
+			Action:    link,
+		},
+		{
+			Name:   "plan",
+			Usage:  "Schedule pending tasks with an estimate into free time within working hours",
+			Action: plan,
+		},
 	}
+
+	return app
+}
+
+// signalContext returns a context which is canceled on the first SIGINT or
+// SIGTERM. Further signals are handled as usual.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-sigChan:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigChan)
+	}()
+
+	return ctx, cancel
 }
 
 func run(ctx *cli.Context) error {
@@ -54,3 +230,21 @@ func run(ctx *cli.Context) error {
 	cli := &cliContext{ctx}
 	return cli.run()
 }
+
+func plan(ctx *cli.Context) error {
+	if ctx.Bool("no-color") {
+		color.NoColor = true
+	}
+
+	cli := &cliContext{ctx}
+	return cli.plan()
+}
+
+func link(ctx *cli.Context) error {
+	if ctx.Bool("no-color") {
+		color.NoColor = true
+	}
+
+	cli := &cliContext{ctx}
+	return cli.link()
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// mapping directions
+const (
+	directionBoth   = "bi"
+	directionToCal  = "to-cal"
+	directionToTask = "to-task"
+)
+
+// fieldMapping declares that a task attribute and an event field hold the
+// same value, and which way changes flow.
+type fieldMapping struct {
+	Task      string `json:"task"`
+	Event     string `json:"event"`
+	Direction string `json:"direction,omitempty"` // bi (default), to-cal or to-task
+	Transform string `json:"transform,omitempty"`
+}
+
+var defaultMappings = []fieldMapping{
+	{Task: "description", Event: "summary", Direction: directionBoth, Transform: "trim"},
+	{Task: "due", Event: "start", Direction: directionBoth},
+	{Task: "annotations", Event: "annotations", Direction: directionBoth},
+	{Task: "location", Event: "location", Direction: directionBoth},
+	{Task: "meeting_url", Event: "meeting_url", Direction: directionToTask},
+	{Task: "attendees", Event: "attendees", Direction: directionToTask},
+	{Task: "rsvp", Event: "rsvp", Direction: directionBoth},
+}
+
+// added to the defaults when colors are configured.
+var colorMappings = []fieldMapping{
+	{Task: colorTaskField, Event: "colorId", Direction: directionBoth},
+	{Task: "project", Event: "private.project", Direction: directionToCal},
+}
+
+var taskDateFields = map[string]bool{
+	"due":                true,
+	"scheduled":          true,
+	"wait":               true,
+	"until":              true,
+	dateScheduledElseDue: true,
+}
+
+// task attributes that can be mapped, besides UDAs.
+var mappableTaskFields = map[string]bool{
+	"description": true,
+	"project":     true,
+	"priority":    true,
+	"due":         true,
+	"scheduled":   true,
+	"wait":        true,
+	"until":       true,
+	"tags":        true,
+	"annotations": true,
+}
+
+// fieldTransform converts values between their task and event forms.
+type fieldTransform struct {
+	toEvent func(string) string
+	toTask  func(string) string
+}
+
+func identity(s string) string { return s }
+
+var builtinTransforms = map[string]fieldTransform{
+	"":      {toEvent: identity, toTask: identity},
+	"trim":  {toEvent: strings.TrimSpace, toTask: strings.TrimSpace},
+	"lower": {toEvent: strings.ToLower, toTask: identity},
+	"upper": {toEvent: strings.ToUpper, toTask: identity},
+}
+
+// valueMapTransform builds a transform from a task value -> event value map.
+// Values not in the map are cleared.
+func valueMapTransform(values map[string]string) fieldTransform {
+	reverse := map[string]string{}
+	for taskValue, eventValue := range values {
+		reverse[eventValue] = taskValue
+	}
+
+	return fieldTransform{
+		toEvent: func(s string) string { return values[s] },
+		toTask:  func(s string) string { return reverse[s] },
+	}
+}
+
+// fieldMap drives unify: every mapping is compared and synced in turn.
+type fieldMap struct {
+	mappings   []fieldMapping
+	transforms map[string]fieldTransform
+
+	colorConfig *colorConfig
+	colors      *eventColors // set by resolveColors
+	dates       *datesConfig
+	managed     map[string]bool // tags left alone by tag mappings
+}
+
+func newFieldMap(cfg *config, dates *datesConfig) (*fieldMap, error) {
+	fm := &fieldMap{transforms: map[string]fieldTransform{}, colorConfig: cfg.Colors, dates: dates, managed: map[string]bool{}}
+	fm.manageTags(dates.UndatedTag)
+
+	for name, t := range builtinTransforms {
+		fm.transforms[name] = t
+	}
+
+	for name, values := range cfg.Transforms {
+		if _, ok := builtinTransforms[name]; ok {
+			return nil, fmt.Errorf("Transform %q is built in and cannot be redefined", name)
+		}
+		fm.transforms[name] = valueMapTransform(values)
+	}
+
+	configured := map[string]bool{}
+	for _, mapping := range cfg.Mappings {
+		configured[mapping.Event] = true
+	}
+
+	defaults := defaultMappings
+	if cfg.Colors.configured() {
+		defaults = append(append([]fieldMapping{}, defaults...), colorMappings...)
+	}
+
+	for _, mapping := range defaults {
+		if mapping.Event == "start" {
+			mapping.Task = dates.Start
+		}
+
+		if !configured[mapping.Event] {
+			fm.mappings = append(fm.mappings, mapping)
+		}
+	}
+
+	for _, mapping := range cfg.Mappings {
+		if mapping.Direction == "" {
+			mapping.Direction = directionBoth
+		}
+
+		if err := fm.validate(mapping); err != nil {
+			return nil, err
+		}
+
+		fm.mappings = append(fm.mappings, mapping)
+	}
+
+	return fm, nil
+}
+
+// manageTags keeps tag mappings from adding or removing the tags calwarrior
+// uses itself, such as the sync tags.
+func (fm *fieldMap) manageTags(tags ...string) {
+	for _, tag := range tags {
+		if tag != "" {
+			fm.managed[tag] = true
+		}
+	}
+}
+
+func (fm *fieldMap) validate(mapping fieldMapping) error {
+	switch mapping.Direction {
+	case directionBoth, directionToCal, directionToTask:
+	default:
+		return fmt.Errorf("Mapping %s -> %s: invalid direction %q", mapping.Task, mapping.Event, mapping.Direction)
+	}
+
+	if _, ok := fm.transforms[mapping.Transform]; !ok {
+		return fmt.Errorf("Mapping %s -> %s: unknown transform %q", mapping.Task, mapping.Event, mapping.Transform)
+	}
+
+	if mapping.Task == "" {
+		return fmt.Errorf("Mapping for %s: task attribute is required", mapping.Event)
+	}
+
+	if mapping.Task == colorTaskField && !fm.colorConfig.configured() {
+		return fmt.Errorf("Mapping %s -> %s: no colors are configured", mapping.Task, mapping.Event)
+	}
+
+	if isKnownTaskField(mapping.Task) && !mappableTaskFields[mapping.Task] {
+		return fmt.Errorf("Mapping %s -> %s: task attribute cannot be mapped", mapping.Task, mapping.Event)
+	}
+
+	if !validEventField(mapping.Event) {
+		return fmt.Errorf("Mapping %s -> %s: unsupported event field", mapping.Task, mapping.Event)
+	}
+
+	if readOnlyEventFields[mapping.Event] && mapping.Direction != directionToTask {
+		return fmt.Errorf("Mapping %s -> %s: event field is read only; use direction to-task", mapping.Task, mapping.Event)
+	}
+
+	if isEventDateField(mapping.Event) && !taskDateFields[mapping.Task] && isKnownTaskField(mapping.Task) {
+		return fmt.Errorf("Mapping %s -> %s: event times can only be mapped to task dates", mapping.Task, mapping.Event)
+	}
+
+	return nil
+}
+
+// sync compares one mapped field and copies the value in the mapping's
+// direction, using taskNewer to decide bidirectional mappings. When linking,
+// the task and event are merged instead: a value set on either side is kept.
+func (fm *fieldMap) sync(mapping fieldMapping, task *taskWarriorItem, event *calendar.Event, taskNewer, linking bool) (bool, error) {
+	t := fm.transforms[mapping.Transform]
+
+	eventValue, err := eventField(event, mapping.Event)
+	if err != nil {
+		return false, err
+	}
+
+	taskValue := t.toEvent(fm.taskField(task, mapping.Task))
+	normalized := t.toEvent(t.toTask(eventValue))
+	if taskValue == normalized {
+		return false, nil
+	}
+
+	toCal := mapping.Direction == directionToCal
+	if mapping.Direction == directionBoth {
+		// once linked, a cleared value syncs like any other; only a first
+		// sync fills in the values missing on either side.
+		switch {
+		case linking && normalized == "":
+			toCal = true
+		case linking && taskValue == "":
+			toCal = false
+		default:
+			toCal = taskNewer
+		}
+	}
+	if toCal {
+		if taskValue == "" && isEventDateField(mapping.Event) {
+			return false, nil // events cannot lose their times
+		}
+
+		if err := setEventField(event, mapping.Event, taskValue); err != nil {
+			return false, err
+		}
+
+		// some fields cannot take every value (e.g. rsvp on an event we were
+		// not invited to); don't report a change that did not happen.
+		after, err := eventField(event, mapping.Event)
+		return err == nil && t.toEvent(t.toTask(after)) != normalized, err
+	}
+
+	return fm.setTaskField(task, mapping.Task, t.toTask(eventValue)), nil
+}
+
+// fillEvent populates a new event from the task.
+func (fm *fieldMap) fillEvent(task *taskWarriorItem, event *calendar.Event) error {
+	for _, mapping := range fm.mappings {
+		if mapping.Direction == directionToTask {
+			continue
+		}
+
+		value := fm.transforms[mapping.Transform].toEvent(fm.taskField(task, mapping.Task))
+		if value == "" {
+			continue
+		}
+
+		if err := setEventField(event, mapping.Event, value); err != nil {
+			return fmt.Errorf("Could not set %s from %s: %w", mapping.Event, mapping.Task, err)
+		}
+	}
+
+	return nil
+}
+
+// fillTask populates a new task from the event.
+func (fm *fieldMap) fillTask(task *taskWarriorItem, event *calendar.Event) error {
+	for _, mapping := range fm.mappings {
+		if mapping.Direction == directionToCal {
+			continue
+		}
+
+		value, err := eventField(event, mapping.Event)
+		if err != nil {
+			return fmt.Errorf("Could not read %s: %w", mapping.Event, err)
+		}
+
+		if value = fm.transforms[mapping.Transform].toTask(value); value != "" {
+			fm.setTaskField(task, mapping.Task, value)
+		}
+	}
+
+	return nil
+}
+
+func isKnownTaskField(name string) bool {
+	for _, known := range taskFieldNames() {
+		if known == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// taskField adds the attributes computed from configuration to taskField.
+func (fm *fieldMap) taskField(task *taskWarriorItem, name string) string {
+	if name == colorTaskField {
+		if fm.colors == nil {
+			return ""
+		}
+		return fm.colors.taskColor(task)
+	}
+
+	if name == dateScheduledElseDue {
+		if task.Scheduled != "" {
+			return string(task.Scheduled)
+		}
+		return string(task.Due)
+	}
+
+	if name == "tags" {
+		return taskField(&taskWarriorItem{Tags: fm.splitTags(task.Tags, false)}, name)
+	}
+
+	return taskField(task, name)
+}
+
+// splitTags returns the tags calwarrior manages, or all others.
+func (fm *fieldMap) splitTags(tags []string, managed bool) []string {
+	split := []string{}
+	for _, tag := range tags {
+		if fm.managed[tag] == managed {
+			split = append(split, tag)
+		}
+	}
+
+	return split
+}
+
+// setTaskField adds the attributes computed from configuration to
+// setTaskField, reporting whether the task changed. Event colors without a
+// priority or project do not change it.
+func (fm *fieldMap) setTaskField(task *taskWarriorItem, name, value string) bool {
+	if name == colorTaskField {
+		return fm.colors != nil && fm.colors.setTaskColor(task, value)
+	}
+
+	if name == dateScheduledElseDue {
+		name = dateScheduled
+		if task.Scheduled == "" && task.Due != "" {
+			name = dateDue
+		}
+	}
+
+	if name == "tags" {
+		managed := fm.splitTags(task.Tags, true)
+		setTaskField(task, name, value)
+		task.Tags = append(managed, fm.splitTags(task.Tags, false)...)
+		return true
+	}
+
+	setTaskField(task, name, value)
+	return true
+}
+
+func taskField(task *taskWarriorItem, name string) string {
+	switch name {
+	case "description":
+		return task.Description
+	case "project":
+		return task.Project
+	case "priority":
+		return task.Priority
+	case "due":
+		return string(task.Due)
+	case "scheduled":
+		return string(task.Scheduled)
+	case "wait":
+		return string(task.Wait)
+	case "until":
+		return string(task.Until)
+	case "tags":
+		tags := append([]string{}, task.Tags...)
+		sort.Strings(tags)
+		return strings.Join(tags, ",")
+	case "annotations":
+		return encodeAnnotations(task.Annotations)
+	}
+
+	if value, ok := task.UDA[name]; ok && value != nil {
+		return fmt.Sprint(value)
+	}
+
+	return ""
+}
+
+func setTaskField(task *taskWarriorItem, name, value string) {
+	switch name {
+	case "description":
+		task.Description = value
+	case "project":
+		task.Project = value
+	case "priority":
+		task.Priority = value
+	case "due":
+		task.Due = taskWarriorTime(value)
+	case "scheduled":
+		task.Scheduled = taskWarriorTime(value)
+	case "wait":
+		task.Wait = taskWarriorTime(value)
+	case "until":
+		task.Until = taskWarriorTime(value)
+	case "tags":
+		task.Tags = nil
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				task.Tags = append(task.Tags, tag)
+			}
+		}
+	case "annotations":
+		task.Annotations = decodeAnnotations(value)
+	default:
+		if task.UDA == nil {
+			task.UDA = map[string]interface{}{}
+		}
+
+		if value == "" {
+			delete(task.UDA, name)
+		} else {
+			task.UDA[name] = value
+		}
+	}
+}
+
+const (
+	privatePropertyPrefix = "private."
+	sharedPropertyPrefix  = "shared."
+)
+
+func isEventDateField(name string) bool {
+	return name == "start" || name == "end"
+}
+
+func validEventField(name string) bool {
+	switch name {
+	case "summary", "description", "annotations", "location", "colorId", "transparency", "visibility", "start", "end", "meeting_url", "attendees", "rsvp":
+		return true
+	}
+
+	return (strings.HasPrefix(name, privatePropertyPrefix) && len(name) > len(privatePropertyPrefix)) ||
+		(strings.HasPrefix(name, sharedPropertyPrefix) && len(name) > len(sharedPropertyPrefix))
+}
+
+func eventField(event *calendar.Event, name string) (string, error) {
+	switch name {
+	case "summary":
+		return event.Summary, nil
+	case "description":
+		return eventUserDescription(event), nil
+	case "annotations":
+		return eventAnnotations(event), nil
+	case "location":
+		return event.Location, nil
+	case "meeting_url":
+		return eventMeetingURL(event), nil
+	case "attendees":
+		return eventAttendees(event), nil
+	case "rsvp":
+		return eventResponse(event), nil
+	case "colorId":
+		return event.ColorId, nil
+	case "transparency":
+		return event.Transparency, nil
+	case "visibility":
+		return event.Visibility, nil
+	case "start":
+		due, err := eventDue(event)
+		return string(due), err
+	case "end":
+		if event.End == nil {
+			return "", nil
+		}
+		end, err := eventDue(&calendar.Event{Start: event.End})
+		return string(end), err
+	}
+
+	if event.ExtendedProperties == nil {
+		return "", nil
+	}
+
+	if strings.HasPrefix(name, privatePropertyPrefix) {
+		return event.ExtendedProperties.Private[strings.TrimPrefix(name, privatePropertyPrefix)], nil
+	}
+
+	return event.ExtendedProperties.Shared[strings.TrimPrefix(name, sharedPropertyPrefix)], nil
+}
+
+func setEventField(event *calendar.Event, name, value string) error {
+	switch name {
+	case "summary":
+		event.Summary = value
+	case "description":
+		setEventUserDescription(event, value)
+	case "annotations":
+		setEventAnnotations(event, value)
+	case "location":
+		event.Location = value
+	case "colorId":
+		event.ColorId = value
+	case "transparency":
+		event.Transparency = value
+	case "visibility":
+		event.Visibility = value
+	case "rsvp":
+		setEventResponse(event, value)
+	case "start":
+		start, err := taskWarriorTime(value).ToGCalIn(eventLocation(event.Start))
+		if err != nil {
+			return err
+		}
+		event.Start = start
+		event.End = start
+	case "end":
+		end, err := taskWarriorTime(value).ToGCalIn(eventLocation(event.End))
+		if err != nil {
+			return err
+		}
+		event.End = end
+	default:
+		if event.ExtendedProperties == nil {
+			event.ExtendedProperties = &calendar.EventExtendedProperties{}
+		}
+
+		props := &event.ExtendedProperties.Shared
+		key := strings.TrimPrefix(name, sharedPropertyPrefix)
+		if strings.HasPrefix(name, privatePropertyPrefix) {
+			props = &event.ExtendedProperties.Private
+			key = strings.TrimPrefix(name, privatePropertyPrefix)
+		}
+
+		if *props == nil {
+			*props = map[string]string{}
+		}
+		(*props)[key] = value
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestFieldMapSyncEmptyValues(t *testing.T) {
+	fm, err := newFieldMap(&config{}, &datesConfig{Start: dateDue})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	location := fieldMapping{Task: "location", Event: "location", Direction: directionBoth}
+
+	table := []struct {
+		name      string
+		task      string
+		event     string
+		taskNewer bool
+		linking   bool
+		want      string
+	}{
+		{"cleared on the task", "", "Room 1", true, false, ""},
+		{"cleared on the event", "Room 1", "", false, false, ""},
+		{"set on the task", "Room 2", "Room 1", true, false, "Room 2"},
+		{"set on the event", "Room 2", "Room 1", false, false, "Room 1"},
+		{"missing on the task when linking", "", "Room 1", true, true, "Room 1"},
+		{"missing on the event when linking", "Room 1", "", false, true, "Room 1"},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			task := &taskWarriorItem{}
+			setTaskField(task, "location", test.task)
+			event := &calendar.Event{Location: test.event}
+
+			if _, err := fm.sync(location, task, event, test.taskNewer, test.linking); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := taskField(task, "location"); got != test.want {
+				t.Fatalf("expected task location %q, got %q", test.want, got)
+			}
+
+			if event.Location != test.want {
+				t.Fatalf("expected event location %q, got %q", test.want, event.Location)
+			}
+		})
+	}
+}
+
+func TestFieldMapSyncKeepsEventTimes(t *testing.T) {
+	fm, err := newFieldMap(&config{}, &datesConfig{Start: dateDue})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := &calendar.EventDateTime{DateTime: "2021-06-01T09:00:00Z"}
+	event := &calendar.Event{Start: start, End: start}
+
+	if _, err := fm.sync(fieldMapping{Task: "due", Event: "start", Direction: directionBoth}, &taskWarriorItem{}, event, true, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Start.DateTime != "2021-06-01T09:00:00Z" {
+		t.Fatalf("expected the event to keep its start, got %q", event.Start.DateTime)
+	}
+}
+
+func TestFieldMapSyncMappings(t *testing.T) {
+	cfg := &config{
+		Mappings: []fieldMapping{
+			{Task: "tags", Event: "private.tags"},
+			{Task: "estimate", Event: "shared.estimate"},
+			{Task: "priority", Event: "colorId", Transform: "priorities"},
+			{Task: "project", Event: "private.project", Transform: "upper", Direction: directionToCal},
+			{Task: "owner", Event: "private.owner", Direction: directionToTask},
+		},
+		Transforms: map[string]map[string]string{"priorities": {"H": "11", "L": "2"}},
+	}
+
+	fm, err := newFieldMap(cfg, &datesConfig{Start: dateDue, UndatedTag: "undated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm.manageTags("calendar", "tentative", "calwarrior_quarantine")
+
+	mappings := map[string]fieldMapping{}
+	for _, mapping := range fm.mappings {
+		mappings[mapping.Event] = mapping
+	}
+
+	table := []struct {
+		name      string
+		mapping   string
+		taskNewer bool
+		task      taskWarriorItem
+		event     string
+		changed   bool
+		wantTask  string
+		wantEvent string
+	}{
+		{"tags to the task", "private.tags", false, taskWarriorItem{Tags: []string{"calendar", "home", "undated"}}, "errand,work", true, "calendar,errand,undated,work", "errand,work"},
+		{"tags to the event", "private.tags", true, taskWarriorItem{Tags: []string{"calendar", "tentative", "work"}}, "home", true, "calendar,tentative,work", "work"},
+		{"only managed tags differ", "private.tags", false, taskWarriorItem{Tags: []string{"calendar", "calwarrior_quarantine", "work"}}, "work", false, "calendar,calwarrior_quarantine,work", "work"},
+		{"tags cleared on the event", "private.tags", false, taskWarriorItem{Tags: []string{"calendar", "work"}}, "", true, "calendar", ""},
+		{"uda to the task", "shared.estimate", false, taskWarriorItem{UDA: map[string]interface{}{"estimate": "PT1H"}}, "PT2H", true, "PT2H", "PT2H"},
+		{"uda to the event", "shared.estimate", true, taskWarriorItem{UDA: map[string]interface{}{"estimate": "PT1H"}}, "PT2H", true, "PT1H", "PT1H"},
+		{"uda cleared on the event", "shared.estimate", false, taskWarriorItem{UDA: map[string]interface{}{"estimate": "PT1H"}}, "", true, "", ""},
+		{"to-task uda with a newer task", "private.owner", true, taskWarriorItem{UDA: map[string]interface{}{"owner": "me"}}, "you", true, "you", "you"},
+		{"transform to the task", "colorId", false, taskWarriorItem{Priority: "L"}, "11", true, "H", "11"},
+		{"transform to the event", "colorId", true, taskWarriorItem{Priority: "H"}, "2", true, "H", "11"},
+		{"unknown transformed value", "colorId", false, taskWarriorItem{Priority: "H"}, "7", true, "", "7"},
+		{"to-cal transform with a newer event", "private.project", false, taskWarriorItem{Project: "work"}, "home", true, "work", "WORK"},
+		{"to-cal transform in sync", "private.project", true, taskWarriorItem{Project: "work"}, "WORK", false, "work", "WORK"},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			mapping := mappings[test.mapping]
+			task := test.task
+			event := &calendar.Event{}
+			if err := setEventField(event, mapping.Event, test.event); err != nil {
+				t.Fatal(err)
+			}
+
+			changed, err := fm.sync(mapping, &task, event, test.taskNewer, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if changed != test.changed {
+				t.Fatalf("expected changed to be %v", test.changed)
+			}
+
+			if got := taskField(&task, mapping.Task); got != test.wantTask {
+				t.Fatalf("expected task %s %q, got %q", mapping.Task, test.wantTask, got)
+			}
+
+			if got, _ := eventField(event, mapping.Event); got != test.wantEvent {
+				t.Fatalf("expected event %s %q, got %q", mapping.Event, test.wantEvent, got)
+			}
+		})
+	}
+}
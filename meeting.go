@@ -0,0 +1,41 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// event fields that can only be read; they may only be mapped to-task.
+var readOnlyEventFields = map[string]bool{
+	"meeting_url": true,
+	"attendees":   true,
+}
+
+// eventMeetingURL returns the link to join the event's video call, if any.
+func eventMeetingURL(event *calendar.Event) string {
+	if event.ConferenceData != nil {
+		for _, entry := range event.ConferenceData.EntryPoints {
+			if entry.EntryPointType == "video" && entry.Uri != "" {
+				return entry.Uri
+			}
+		}
+	}
+
+	return event.HangoutLink
+}
+
+// eventAttendees lists the attendees' email addresses, sorted, without
+// resources such as meeting rooms.
+func eventAttendees(event *calendar.Event) string {
+	emails := []string{}
+	for _, attendee := range event.Attendees {
+		if !attendee.Resource && attendee.Email != "" {
+			emails = append(emails, attendee.Email)
+		}
+	}
+
+	sort.Strings(emails)
+	return strings.Join(emails, ",")
+}
@@ -1,23 +1,49 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/api/calendar/v3"
 )
 
-func unify(task *taskWarriorItem, event *calendar.Event) (bool, error) {
+// unify links the task and event and syncs the fields declared in fm.
+func unify(fm *fieldMap, task *taskWarriorItem, event *calendar.Event) (bool, error) {
 	if task == nil || event == nil {
 		return false, errors.New("nil event or task passed")
 	}
 
 	modified := false
-	taskNewer := true
+	taskNewer, _ := taskIsNewer(task, event)
 
+	// a task and event being linked have not been synced before
+	linking := task.CalendarID != event.Id
+	if linking {
+		task.CalendarID = event.Id
+		modified = true
+	}
+
+	for _, mapping := range fm.mappings {
+		changed, err := fm.sync(mapping, task, event, taskNewer, linking)
+		if err != nil {
+			return false, fmt.Errorf("Task %q could not sync %s with %s of calendar id %q: %w", task.UUID, mapping.Task, mapping.Event, event.Id, err)
+		}
+
+		modified = modified || changed
+	}
+
+	return modified, nil
+}
+
+// taskIsNewer reports whether the task was modified after the event. tie is
+// true when the two cannot be told apart, in which case the task wins.
+func taskIsNewer(task *taskWarriorItem, event *calendar.Event) (newer bool, tie bool) {
 	taskModified, err := task.Modified.ToTime()
 	if err != nil {
 		taskModified = time.Time{}
@@ -35,70 +61,52 @@ func unify(task *taskWarriorItem, event *calendar.Event) (bool, error) {
 		}
 	}
 
-	if taskModified.Before(calModified) {
-		taskNewer = false
-	}
-
-	if task.CalendarID != event.Id {
-		task.CalendarID = event.Id
-		modified = true
-	}
-
-	if strings.TrimSpace(task.Description) != strings.TrimSpace(event.Summary) {
-		if taskNewer {
-			event.Summary = strings.TrimSpace(task.Description)
-			task.Description = event.Summary
-		} else {
-			task.Description = strings.TrimSpace(event.Summary)
-			event.Summary = task.Description
-		}
-		modified = true
-	}
-
-	due, err := eventDue(event)
-	if err != nil {
-		return false, err
-	}
-
-	if due != task.Due {
-		if taskNewer {
-			var err error
-			event.Start, err = task.Due.ToGCal()
-			event.End = event.Start
-			if err != nil {
-				return false, fmt.Errorf("Task %q could not assign start time to calendar id %q: %w", task.UUID, event.Id, err)
-			}
-		} else {
-			task.Due = due
-		}
-
-		modified = true
-	}
-
-	return modified, nil
+	return !taskModified.Before(calModified), taskModified.Equal(calModified)
 }
 
 type merge struct {
-	tw  *taskWarrior
-	cal *calendarClient
-	ctx *cliContext
-	log logger
+	tw         *taskWarrior
+	cal        *calendarClient
+	ctx        *cliContext
+	log        logger
+	report     *syncReport
+	fields     *fieldMap
+	completion *completionConfig
+	filter     []string // taskwarrior filter arguments, besides the tags
+	events     *eventFilter
 
 	unsyncedEvents    []*calendar.Event
 	eventsIDMap       map[string]*calendar.Event
 	unsyncedTasks     taskWarriorItems
 	checkTasks        taskWarriorItems
 	deletedTasks      taskWarriorItems
+	completedTasks    taskWarriorItems // linked, and handled by the completion policy
 	deletedTaskCalMap map[string]*taskWarriorItem
 	taskIDMap         map[string]*taskWarriorItem
+	ignoredEvents     map[string]bool
+	failedTasks       map[*taskWarriorItem]bool
+	errors            syncErrors
+	batch             *calendarBatch
+	modifiedEvents    map[string]bool            // events changed by unify before being fetched
+	modifiedTasks     map[*taskWarriorItem]bool  // tasks changed by this run
+	fetchErrors       map[string]error           // calendar ID -> error retrieving it
+	exportedStatus    map[string]string          // task UUID -> status when exported
+	planEvents        map[string]*calendar.Event // planned time blocks, by ID
+	markerEvents      map[string]*calendar.Event // all-day markers, by ID
+	undatedDate       time.Time                  // given to tasks without a date
 }
 
-func newMerge(ctx *cliContext, tw *taskWarrior, cal *calendarClient) *merge {
+func newMerge(ctx *cliContext, tw *taskWarrior, cal *calendarClient, log logger, fields *fieldMap, completion *completionConfig, filter []string, events *eventFilter) *merge {
 	return &merge{
-		tw:  tw,
-		cal: cal,
-		ctx: ctx,
-		log: logLevel(os.Getenv("DEBUG") != ""),
+		tw:         tw,
+		cal:        cal,
+		ctx:        ctx,
+		log:        log,
+		report:     newSyncReport(),
+		fields:     fields,
+		completion: completion,
+		filter:     filter,
+		events:     events,
 
 		unsyncedEvents:    []*calendar.Event{},
 		eventsIDMap:       map[string]*calendar.Event{},
@@ -107,6 +115,53 @@ func newMerge(ctx *cliContext, tw *taskWarrior, cal *calendarClient) *merge {
 		deletedTasks:      taskWarriorItems{},
 		deletedTaskCalMap: map[string]*taskWarriorItem{},
 		taskIDMap:         map[string]*taskWarriorItem{},
+		ignoredEvents:     map[string]bool{},
+		failedTasks:       map[*taskWarriorItem]bool{},
+		batch:             &calendarBatch{},
+		modifiedEvents:    map[string]bool{},
+		modifiedTasks:     map[*taskWarriorItem]bool{},
+		fetchErrors:       map[string]error{},
+		exportedStatus:    map[string]string{},
+		planEvents:        map[string]*calendar.Event{},
+		markerEvents:      map[string]*calendar.Event{},
+	}
+}
+
+// syncErrors is returned from run when individual items failed, but the rest
+// of the sync went through.
+type syncErrors []error
+
+func (e syncErrors) Error() string {
+	lines := []string{fmt.Sprintf("%d item(s) failed to sync:", len(e))}
+	for _, err := range e {
+		lines = append(lines, "  "+err.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// updateTask queues a task changed outside of unify for import.
+func (m *merge) updateTask(task *taskWarriorItem) {
+	m.modifiedTasks[task] = true
+	m.checkTasks = append(m.checkTasks, task)
+}
+
+// itemFailed records an error for a single task and/or event. The task is
+// skipped for the rest of the run and not imported.
+func (m *merge) itemFailed(task *taskWarriorItem, event *calendar.Event, err error) {
+	switch {
+	case task != nil && task.UUID != "":
+		err = fmt.Errorf("Task %q (%.20q): %w", task.UUID, task.Description, err)
+	case event != nil:
+		err = fmt.Errorf("Event %q (%.20q): %w", event.Id, event.Summary, err)
+	}
+
+	m.log.ItemError(task, event, err)
+	m.report.addError(task, event, err)
+	m.errors = append(m.errors, err)
+
+	if task != nil {
+		m.failedTasks[task] = true
 	}
 }
 
@@ -116,8 +171,19 @@ func (m *merge) makeIDMaps(tasks taskWarriorItems, events *calendar.Events) {
 	}
 
 	for _, task := range tasks {
+		if m.keepsCompletedEvent(task) {
+			if event, ok := m.eventsIDMap[task.CalendarID]; ok && eventResponse(event) != responseDeclined {
+				m.completedTasks = append(m.completedTasks, task)
+			}
+
+			// the event still belongs to the task
+			m.taskIDMap[task.CalendarID] = task
+			continue
+		}
+
 		if task.Status == "deleted" || task.Status == "completed" {
-			if _, ok := m.eventsIDMap[task.CalendarID]; ok && task.CalendarID != "" {
+			// tasks closed because the event was declined keep the event
+			if event, ok := m.eventsIDMap[task.CalendarID]; ok && task.CalendarID != "" && eventResponse(event) != responseDeclined {
 				m.deletedTasks = append(m.deletedTasks, task)
 				m.deletedTaskCalMap[task.CalendarID] = task
 			}
@@ -137,16 +203,26 @@ func (m *merge) makeIDMaps(tasks taskWarriorItems, events *calendar.Events) {
 
 func (m *merge) determineAlreadySyncedTaskWarrior(events *calendar.Events) error {
 	for _, event := range events.Items {
+		if m.ignoredEvents[event.Id] {
+			continue
+		}
+
 		task, ok := m.taskIDMap[event.Id]
 		if !ok {
 			m.unsyncedEvents = append(m.unsyncedEvents, event)
-		} else {
-			modified, err := unify(task, event)
+		} else if !m.keepsCompletedEvent(task) {
+			before, _ := json.Marshal(event)
+
+			modified, err := m.unify(task, event)
 			if err != nil {
-				return err
+				m.itemFailed(task, event, fmt.Errorf("Error reconciling task and event: %w", err))
+				continue
 			}
 
 			if modified {
+				if after, _ := json.Marshal(event); !bytes.Equal(before, after) {
+					m.modifiedEvents[event.Id] = true
+				}
 				m.checkTasks = append(m.checkTasks, task)
 			}
 		}
@@ -167,85 +243,283 @@ func (m *merge) syncTasks() error {
 			continue
 		}
 
+		if eventResponse(event) == responseDeclined {
+			m.log.Debugf("Skipping declined event %q (%.20q)", event.Id, event.Summary)
+			continue
+		}
+
+		if reason := m.events.skip(event); reason != "" {
+			m.log.Debugf("Skipping event %q (%.20q): %s", event.Id, event.Summary, reason)
+			continue
+		}
+
 		m.log.SyncTask(event)
-		due, err := eventDue(event)
-		if err != nil {
-			return err
+
+		task := &taskWarriorItem{
+			Status:     "pending",
+			Entry:      toTaskWarriorTime(time.Now()),
+			CalendarID: event.Id,
 		}
 
-		m.checkTasks = append(m.checkTasks, &taskWarriorItem{
-			Description: strings.TrimSpace(event.Summary),
-			Status:      "pending",
-			Entry:       toTaskWarriorTime(time.Now()),
-			Due:         due,
-			Tags:        tags,
-			CalendarID:  event.Id,
-		})
+		if err := m.fields.fillTask(task, event); err != nil {
+			m.itemFailed(nil, event, err)
+			continue
+		}
+
+		task.Tags = tags.addTo(task.Tags)
+		m.applyResponse(task, event)
+		m.checkTasks = append(m.checkTasks, task)
 	}
 
 	return nil
 }
 
-func (m *merge) get() (taskWarriorItems, *calendar.Events, error) {
+func (m *merge) get(ctx context.Context) (taskWarriorItems, *calendar.Events, error) {
 	tags, err := m.ctx.makeTags()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	tasks, err := m.tw.exportTasksByCommand(append([]string{"export"}, tags.decorate()...)...)
+	args := append(append([]string{"export"}, tags.decorate()...), m.filter...)
+	tasks, err := m.tw.exportTasksByCommand(ctx, append(args, m.ctx.quarantineFilter()...)...)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	for _, task := range tasks {
+		m.exportedStatus[task.UUID] = task.Status
+	}
+
+	if err := m.ignoreFiltered(ctx, tags, tasks); err != nil {
+		return nil, nil, err
+	}
+
+	if err := m.ignoreQuarantined(ctx, tags); err != nil {
+		return nil, nil, err
+	}
+
 	t1, t2 := m.ctx.getTimeWindow()
 
-	events, err := m.cal.gatherEvents(t1, t2)
+	events, err := m.cal.gatherEvents(ctx, t1, t2)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Trouble gathering events: %w", err)
+		return nil, nil, calendarFailure(fmt.Errorf("Trouble gathering events: %w", err))
+	}
+
+	if err := m.events.loadTypes(ctx, m.cal, t1, t2); err != nil {
+		return nil, nil, calendarFailure(fmt.Errorf("Trouble gathering event types: %w", err))
 	}
 
+	// time log, plan and marker events may share the calendar; they are not
+	// tasks
+	items := events.Items[:0]
+	for _, event := range events.Items {
+		switch {
+		case eventIsTimeLog(event):
+		case eventPlanTask(event) != "":
+			m.planEvents[event.Id] = event
+		case isMarker(event):
+			m.markerEvents[event.Id] = event
+		default:
+			items = append(items, event)
+		}
+	}
+	events.Items = items
+
 	return tasks, events, nil
 }
 
+// fetchEvents retrieves the events for linked tasks which were not returned
+// by gatherEvents, using a bounded number of concurrent requests. Fetched
+// events are added to eventsIDMap; failures are kept in fetchErrors.
+func (m *merge) fetchEvents(ctx context.Context, tasks taskWarriorItems) {
+	ids := []string{}
+	seen := map[string]bool{}
+
+	for _, task := range tasks {
+		if task.CalendarID == "" || seen[task.CalendarID] {
+			continue
+		}
+		seen[task.CalendarID] = true
+
+		if _, ok := m.eventsIDMap[task.CalendarID]; !ok {
+			ids = append(ids, task.CalendarID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	m.log.Debugf("Fetching %d events outside the time window", len(ids))
+
+	events := make([]*calendar.Event, len(ids))
+	errs := make([]error, len(ids))
+
+	m.concurrently(ctx, len(ids), func(ctx context.Context, i int) {
+		events[i], errs[i] = m.cal.getEvent(ctx, ids[i])
+	})
+
+	for i, id := range ids {
+		if errs[i] != nil && m.taskIDMap[id] != nil && m.taskIDMap[id].Status == "pending" {
+			events[i], errs[i] = m.restoreMovedEvent(ctx, id, errs[i])
+		}
+
+		switch {
+		case errs[i] != nil:
+			m.fetchErrors[id] = errs[i]
+		case events[i] == nil:
+			m.fetchErrors[id] = ctx.Err() // never fetched
+		default:
+			m.eventsIDMap[id] = events[i]
+		}
+	}
+}
+
+// concurrently calls f for every index in [0, count), with at most
+// --concurrency calls in flight. No further calls are started once ctx is
+// canceled.
+func (m *merge) concurrently(ctx context.Context, count int, f func(context.Context, int)) {
+	workers := m.ctx.Int("concurrency")
+	if workers < 1 {
+		workers = 1
+	}
+
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				f(ctx, i)
+			}
+		}()
+	}
+
+	defer wg.Wait()
+	defer close(indexes)
+
+	for i := 0; i < count; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func (m *merge) mergeExistingEvent(task *taskWarriorItem) (bool, error) {
-	event, err := m.cal.getEvent(task.CalendarID)
-	if err != nil {
+	event, ok := m.eventsIDMap[task.CalendarID]
+	if !ok {
+		err := m.fetchErrors[task.CalendarID]
+		if err == nil {
+			err = errors.New("event was not fetched")
+		}
 		m.log.Warnf("Could not retrieve event for calendar ID (already removed?) %q: %v", task.CalendarID, err)
 		return false, nil
 	}
 
-	modified, err := unify(task, event)
+	modified, err := m.unify(task, event)
 	if err != nil {
 		return false, fmt.Errorf("Error reconciling task and event: %w", err)
 	}
 
-	if modified {
+	// the event may already have been reconciled against the task in
+	// determineAlreadySyncedTaskWarrior; it still needs to be written.
+	if modified || m.modifiedEvents[event.Id] {
+		modified = true
+
 		if event.Summary == "CANCELLED" {
 			return false, nil // hack for canceled events
 		}
-		event, err = m.cal.modifyEvent(event)
-		if err != nil {
-			return false, fmt.Errorf("Error modifying calendar event: %w", err)
-		}
+		m.batch.modify(event, func(_ *calendar.Event, err error) {
+			if err != nil {
+				m.itemFailed(task, nil, fmt.Errorf("Error modifying calendar event: %w", err))
+				return
+			}
+			m.report.count(func(r *syncReport) { r.Calendar.Updated++ })
+		})
 	}
 	return modified, nil
 }
 
-func (m *merge) createNewEvent(task *taskWarriorItem, due *calendar.EventDateTime) (bool, error) {
-	var err error
+// createNewEvent queues the insert of an event for the task. Once inserted,
+// the task is linked to the event and queued for import. The event ID is
+// derived from the task, so retrying the insert cannot create a duplicate.
+func (m *merge) createNewEvent(ctx context.Context, task *taskWarriorItem, due *calendar.EventDateTime) {
+	event := &calendar.Event{
+		Start: due,
+		End:   due,
+	}
+
+	if err := m.fields.fillEvent(task, event); err != nil {
+		m.itemFailed(task, nil, err)
+		return
+	}
+
+	if task.UUID != "" {
+		event.Id = eventIDForTask(task)
+		setEventTaskUUID(event, task)
+	}
 
-	event, err := m.cal.insertEvent(&calendar.Event{
-		Summary: task.Description,
-		Start:   due,
-		End:     due,
+	m.batch.insert(event, func(event *calendar.Event, err error) {
+		if err != nil {
+			event, err = m.recoverExistingEvent(ctx, task, err)
+			if err != nil {
+				m.itemFailed(task, nil, fmt.Errorf("Error inserting calendar event: %w", err))
+				return
+			}
+		} else {
+			m.report.count(func(r *syncReport) { r.Calendar.Created++ })
+		}
+
+		modified, err := m.unify(task, event)
+		if err != nil {
+			m.itemFailed(task, event, fmt.Errorf("Error reconciling task and event: %w", err))
+			return
+		}
+
+		if modified {
+			m.checkTasks = append(m.checkTasks, task)
+		}
 	})
+}
+
+// keepsCompletedEvent reports whether the task is linked and completed, and
+// its event is kept according to the completion policy.
+func (m *merge) keepsCompletedEvent(task *taskWarriorItem) bool {
+	return task.Status == "completed" && task.CalendarID != "" && m.completion.Policy != completeDelete
+}
+
+// unify reconciles the task and event, noting a conflict when neither side
+// can be determined to be newer. Events of reopened tasks lose their
+// completed marking first.
+func (m *merge) unify(task *taskWarriorItem, event *calendar.Event) (bool, error) {
+	before, _ := json.Marshal(task)
+	defer func() {
+		if after, _ := json.Marshal(task); !bytes.Equal(before, after) {
+			m.modifiedTasks[task] = true
+		}
+	}()
+
+	unmarked := task.Status == "pending" && m.completion.unmarkCompleted(event)
+
+	modified, err := unify(m.fields, task, event)
 	if err != nil {
-		return false, fmt.Errorf("Error inserting calendar event: %w", err)
+		return false, err
 	}
 
-	modified, err := unify(task, event)
-	if err != nil {
-		return false, fmt.Errorf("Error reconciling task and event: %w", err)
+	modified = modified || unmarked
+
+	if m.applyResponse(task, event) {
+		modified = true
+	}
+
+	if modified {
+		if _, tie := taskIsNewer(task, event); tie {
+			m.report.addConflict(task, event, "task and event have the same modification time; kept the task's values")
+		}
 	}
 
 	return modified, nil
@@ -258,6 +532,10 @@ func (m *merge) filterTasks() {
 
 	// overwrite in order
 	for _, task := range m.checkTasks {
+		if m.failedTasks[task] {
+			continue
+		}
+
 		// skip if no UUID
 		if task.UUID == "" {
 			m.log.AddTask(task)
@@ -266,7 +544,7 @@ func (m *merge) filterTasks() {
 		}
 
 		if _, ok := tm[task.UUID]; ok {
-			fmt.Printf("Filtering duplicate task %q (%q)\n", task.UUID, task.Description)
+			m.log.Warnf("Filtering duplicate task %q (%q)", task.UUID, task.Description)
 		}
 
 		tm[task.UUID] = task
@@ -279,13 +557,33 @@ func (m *merge) filterTasks() {
 	m.checkTasks = newTasks
 }
 
-func (m *merge) run() error {
-	tasks, events, err := m.get()
+// countImported counts the imported tasks which were created, deleted or
+// otherwise changed. Linked tasks are imported whether they changed or not.
+func (m *merge) countImported() {
+	for _, task := range m.checkTasks {
+		switch {
+		case task.UUID == "":
+			m.report.count(func(r *syncReport) { r.Taskwarrior.Created++ })
+		case task.Status == "deleted" && m.exportedStatus[task.UUID] != "deleted":
+			m.report.count(func(r *syncReport) { r.Taskwarrior.Deleted++ })
+		case m.modifiedTasks[task]:
+			m.report.count(func(r *syncReport) { r.Taskwarrior.Updated++ })
+		}
+	}
+}
+
+// run performs the sync. If ctx is canceled, the sync stops before anything is
+// imported into taskwarrior.
+func (m *merge) run(ctx context.Context) error {
+	tasks, events, err := m.get(ctx)
 	if err != nil {
 		return err
 	}
 
 	m.makeIDMaps(tasks, events)
+	m.relinkEvents()
+
+	m.adoptEvents()
 
 	if err := m.determineAlreadySyncedTaskWarrior(events); err != nil {
 		return err
@@ -295,25 +593,35 @@ func (m *merge) run() error {
 		return err
 	}
 
+	m.selectOutsideWindow()
+	m.fetchEvents(ctx, m.checkTasks)
+	m.deleteClosedOutsideWindow()
+
+	if err := m.resolveUndatedDate(ctx); err != nil {
+		return err
+	}
+
 	for _, task := range m.checkTasks {
 		var action bool
 
+		if m.failedTasks[task] {
+			continue
+		}
+
 		if task.CalendarID != "" {
 			action, err = m.mergeExistingEvent(task)
 			if err != nil {
-				return err
+				m.itemFailed(task, nil, err)
+				continue
 			}
 		} else {
-			due, err := task.Due.ToGCal()
-			if err != nil {
-				return fmt.Errorf("Task %q (%.20q) Could not convert due time to gcal event time: %w", task.UUID, task.Description, err)
+			due, ok := m.eventStart(task)
+			if !ok {
+				continue
 			}
 
 			m.log.SyncEvent(task)
-			action, err = m.createNewEvent(task, due)
-			if err != nil {
-				return err
-			}
+			m.createNewEvent(ctx, task, due)
 		}
 
 		if action {
@@ -322,33 +630,62 @@ func (m *merge) run() error {
 	}
 
 	for _, task := range m.unsyncedTasks {
-		due, err := task.Due.ToGCal()
-		if err != nil {
-			return fmt.Errorf("Task %q (%.20q) Could not convert due time to gcal event time: %w", task.UUID, task.Description, err)
-		}
-
-		modified, err := m.createNewEvent(task, due)
-		if err != nil {
-			return err
+		due, ok := m.eventStart(task)
+		if !ok {
+			continue
 		}
 
-		if modified {
-			m.checkTasks = append(m.checkTasks, task)
-		}
+		m.createNewEvent(ctx, task, due)
 	}
 
 	for _, task := range m.deletedTasks {
-		if err := m.cal.deleteEvent(task.CalendarID); err == nil {
+		task := task
+		m.batch.delete(task.CalendarID, func(err error) {
+			if err != nil {
+				m.itemFailed(task, nil, fmt.Errorf("Error deleting calendar event: %w", err))
+				return
+			}
 			m.log.DeleteEvent(m.eventsIDMap[task.CalendarID])
-		} else {
+			m.report.count(func(r *syncReport) { r.Calendar.Deleted++ })
+		})
+	}
+
+	m.completeEvents()
+	m.syncMarkers(ctx, tasks)
+
+	timeLog, err := m.logTime(tasks)
+	if err != nil {
+		m.log.Error(err)
+	}
+
+	m.cal.runBatch(ctx, m.batch)
+
+	if timeLog != nil {
+		if err := saveState(timeLogFile, timeLog); err != nil {
 			m.log.Error(err)
 		}
 	}
 
+	m.followPlans(tasks)
+
 	m.filterTasks()
 
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("Sync aborted before importing tasks: %w", err)
+	}
+
 	if err := m.tw.importTasks(m.checkTasks); err != nil {
-		return fmt.Errorf("Could not import tasks: %w", err)
+		return taskwarriorFailure(fmt.Errorf("Could not import tasks: %w", err))
+	}
+
+	m.countImported()
+
+	if err := m.quarantine(ctx, tasks); err != nil {
+		m.log.Error(err)
+	}
+
+	if len(m.errors) > 0 {
+		return m.errors
 	}
 
 	return nil
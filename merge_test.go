@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+	"google.golang.org/api/calendar/v3"
+)
+
+// testContext parses args with the application's flags.
+func testContext(t *testing.T, args ...string) *cliContext {
+	app := newApp()
+	set := flag.NewFlagSet("calwarrior", flag.ContinueOnError)
+
+	for _, f := range app.Flags {
+		if err := f.Apply(set); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	return &cliContext{cli.NewContext(app, set, nil)}
+}
+
+// testMerge returns a merge of tasks and events which does not talk to
+// taskwarrior or the calendar.
+func testMerge(t *testing.T, cfg *config, dates *datesConfig, args ...string) *merge {
+	fm, err := newFieldMap(cfg, dates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := makeLogger("text", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newMerge(testContext(t, args...), nil, nil, log, fm, &completionConfig{}, nil, nil)
+}
+
+func linkedPair(id, summary, updated string) (*taskWarriorItem, *calendar.Event) {
+	start := &calendar.EventDateTime{DateTime: "2021-06-01T09:00:00Z"}
+
+	task := &taskWarriorItem{
+		UUID:        id + "-uuid",
+		Status:      "pending",
+		Description: "Write report",
+		Due:         "20210601T090000Z",
+		Modified:    "20210601T080000Z",
+		CalendarID:  id,
+	}
+
+	event := &calendar.Event{Id: id, Summary: summary, Start: start, End: start, Updated: updated}
+
+	return task, event
+}
+
+func TestReportCountsChangedTasks(t *testing.T) {
+	m := testMerge(t, &config{}, &datesConfig{Start: dateDue})
+
+	unchanged, unchangedEvent := linkedPair("unchanged", "Write report", "2021-06-01T07:00:00Z")
+	changed, changedEvent := linkedPair("changed", "Write the report", "2021-06-01T10:00:00Z")
+
+	events := &calendar.Events{Items: []*calendar.Event{unchangedEvent, changedEvent}}
+
+	m.makeIDMaps(taskWarriorItems{unchanged, changed}, events)
+	if err := m.determineAlreadySyncedTaskWarrior(events); err != nil {
+		t.Fatal(err)
+	}
+	m.filterTasks()
+	m.countImported()
+
+	if m.report.Taskwarrior.Updated != 1 {
+		t.Fatalf("expected one updated task, got %d", m.report.Taskwarrior.Updated)
+	}
+
+	if changed.Description != "Write the report" || unchanged.Description != "Write report" {
+		t.Fatalf("unexpected descriptions %q and %q", changed.Description, unchanged.Description)
+	}
+
+	if m.report.Taskwarrior.Created != 0 || m.report.Taskwarrior.Deleted != 0 {
+		t.Fatalf("expected no created or deleted tasks, got %+v", m.report.Taskwarrior)
+	}
+}
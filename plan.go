@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// marks planned time blocks; the value is the task's UUID.
+const planProperty = "calwarriorPlan"
+
+// slots start on these boundaries.
+const planGranularity = 15 * time.Minute
+
+// planConfig controls how `calwarrior plan` places tasks in the calendar.
+type planConfig struct {
+	Estimate string   `json:"estimate"` // the UDA holding the estimate; default "estimate"
+	Start    string   `json:"start"`    // start of working hours; default "09:00"
+	End      string   `json:"end"`      // end of working hours; default "17:00"
+	Days     []string `json:"days"`     // working days; default mon through fri
+
+	start, end time.Duration
+	days       map[time.Weekday]bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// planning returns the plan settings with defaults filled in.
+func planning(cfg *config) (*planConfig, error) {
+	pc := planConfig{}
+	if cfg.Plan != nil {
+		pc = *cfg.Plan
+	}
+
+	if pc.Estimate == "" {
+		pc.Estimate = "estimate"
+	}
+
+	if pc.Start == "" {
+		pc.Start = "09:00"
+	}
+
+	if pc.End == "" {
+		pc.End = "17:00"
+	}
+
+	if len(pc.Days) == 0 {
+		pc.Days = []string{"mon", "tue", "wed", "thu", "fri"}
+	}
+
+	var err error
+	if pc.start, err = parseClock(pc.Start); err != nil {
+		return nil, err
+	}
+
+	if pc.end, err = parseClock(pc.End); err != nil {
+		return nil, err
+	}
+
+	if pc.end <= pc.start {
+		return nil, fmt.Errorf("Working hours end (%s) must be after they start (%s)", pc.End, pc.Start)
+	}
+
+	pc.days = map[time.Weekday]bool{}
+	for _, day := range pc.Days {
+		wd, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return nil, fmt.Errorf("Invalid working day %q: must be one of sun, mon, tue, wed, thu, fri or sat", day)
+		}
+		pc.days[wd] = true
+	}
+
+	return &pc, nil
+}
+
+// parseClock parses a time of day such as 09:30 into the offset from midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid time of day %q: must be formatted as HH:MM", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseEstimate reads an estimate, either a taskwarrior duration (exported as
+// ISO 8601, e.g. PT1H30M) or a Go duration such as 1h30m.
+func parseEstimate(value interface{}) (time.Duration, error) {
+	s, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("Invalid estimate %v", value)
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+
+	parts := isoDuration.FindStringSubmatch(s)
+	if parts == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("Invalid estimate %q", s)
+	}
+
+	d := time.Duration(0)
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if parts[i+1] == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(parts[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("Invalid estimate %q: %w", s, err)
+		}
+		d += time.Duration(n) * unit
+	}
+
+	return d, nil
+}
+
+type timeSlot struct {
+	start, end time.Time
+}
+
+// workingSlots returns the working hours between t1 and t2.
+func (pc *planConfig) workingSlots(t1, t2 time.Time) []timeSlot {
+	slots := []timeSlot{}
+
+	for day := time.Date(t1.Year(), t1.Month(), t1.Day(), 0, 0, 0, 0, t1.Location()); day.Before(t2); day = day.AddDate(0, 0, 1) {
+		if !pc.days[day.Weekday()] {
+			continue
+		}
+
+		slot := timeSlot{start: clockOn(day, pc.start), end: clockOn(day, pc.end)}
+		if slot.start.Before(t1) {
+			slot.start = t1
+		}
+
+		if slot.end.After(t2) {
+			slot.end = t2
+		}
+
+		if slot.start.Before(slot.end) {
+			slots = append(slots, slot)
+		}
+	}
+
+	return slots
+}
+
+// clockOn returns the wall clock time of day on the given day. Adding the
+// offset to midnight instead would be an hour off on DST changes.
+func clockOn(day time.Time, clock time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), int(clock/time.Hour), int(clock%time.Hour/time.Minute), 0, 0, day.Location())
+}
+
+// freeSlots removes the busy periods from slots.
+func freeSlots(slots []timeSlot, busy []timeSlot) []timeSlot {
+	for _, b := range busy {
+		free := []timeSlot{}
+
+		for _, slot := range slots {
+			if !b.start.Before(slot.end) || !b.end.After(slot.start) {
+				free = append(free, slot)
+				continue
+			}
+
+			if slot.start.Before(b.start) {
+				free = append(free, timeSlot{start: slot.start, end: b.start})
+			}
+
+			if b.end.Before(slot.end) {
+				free = append(free, timeSlot{start: b.end, end: slot.end})
+			}
+		}
+
+		slots = free
+	}
+
+	return slots
+}
+
+// place takes the first free slot long enough for d out of slots.
+func place(slots []timeSlot, d time.Duration) (timeSlot, bool) {
+	for i, slot := range slots {
+		start := slot.start.Add(planGranularity - 1).Truncate(planGranularity)
+		if end := start.Add(d); !end.After(slot.end) {
+			slots[i].start = end
+			return timeSlot{start: start, end: end}, true
+		}
+	}
+
+	return timeSlot{}, false
+}
+
+// busySlots queries the busy periods of the primary calendar.
+func (cal *calendarClient) busySlots(ctx context.Context, t1, t2 time.Time) ([]timeSlot, error) {
+	resp, err := cal.Freebusy.Query(&calendar.FreeBusyRequest{
+		TimeMin: string(toCalendarTime(t1)),
+		TimeMax: string(toCalendarTime(t2)),
+		Items:   []*calendar.FreeBusyRequestItem{{Id: "primary"}},
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	busy := []timeSlot{}
+	for id, fb := range resp.Calendars {
+		if len(fb.Errors) > 0 {
+			return nil, fmt.Errorf("Calendar %q: %s", id, fb.Errors[0].Reason)
+		}
+
+		for _, period := range fb.Busy {
+			start, err := time.Parse(time.RFC3339, period.Start)
+			if err != nil {
+				return nil, err
+			}
+
+			end, err := time.Parse(time.RFC3339, period.End)
+			if err != nil {
+				return nil, err
+			}
+
+			busy = append(busy, timeSlot{start: start, end: end})
+		}
+	}
+
+	return busy, nil
+}
+
+// planEventID derives the ID of a task's time block, so planning again after
+// the tasks could not be imported cannot create a second block.
+func planEventID(task *taskWarriorItem) string {
+	return eventIDForTask(task) + "plan"
+}
+
+func eventPlanTask(event *calendar.Event) string {
+	if event.ExtendedProperties == nil {
+		return ""
+	}
+
+	return event.ExtendedProperties.Private[planProperty]
+}
+
+// planned reports whether the task's time block still exists.
+func (cal *calendarClient) planned(ctx context.Context, task *taskWarriorItem) (bool, error) {
+	if task.PlanID == "" {
+		return false, nil
+	}
+
+	event, err := cal.getEvent(ctx, task.PlanID)
+	if err != nil {
+		if isGone(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return event.Status != "cancelled", nil
+}
+
+// recoverPlan handles an insert that failed because the task's time block ID
+// is already taken: a block that still exists was planned by a run whose
+// import failed and is kept; a deleted block is restored in the new slot.
+func (cal *calendarClient) recoverPlan(ctx context.Context, log logger, task *taskWarriorItem, block *calendar.Event, insertErr error) (*calendar.Event, error) {
+	if !isConflict(insertErr) {
+		return nil, insertErr
+	}
+
+	event, err := cal.getEvent(ctx, block.Id)
+	if err != nil {
+		return nil, fmt.Errorf("Time block ID exists but could not be retrieved: %w", err)
+	}
+
+	if event.Status != "cancelled" {
+		log.Noticef("Task %q (%.20q) is already planned in time block %q", task.UUID, task.Description, event.Id)
+		return event, nil
+	}
+
+	log.Noticef("Restoring deleted time block %q for task %q (%.20q)", event.Id, task.UUID, task.Description)
+	block.Status = "confirmed"
+	return cal.modifyEvent(ctx, block)
+}
+
+// followPlans moves the scheduled date of tasks whose time block was moved in
+// the calendar.
+func (m *merge) followPlans(tasks taskWarriorItems) {
+	for _, task := range tasks {
+		event, ok := m.planEvents[task.PlanID]
+		if !ok || task.PlanID == "" || m.failedTasks[task] || eventPlanTask(event) != task.UUID {
+			continue
+		}
+
+		scheduled, err := eventDue(event)
+		if err != nil {
+			m.itemFailed(task, event, fmt.Errorf("Could not read the start of the planned time block: %w", err))
+			continue
+		}
+
+		if scheduled != task.Scheduled {
+			m.log.Noticef("Rescheduling task %q (%.20q) to %s", task.UUID, task.Description, scheduled)
+			task.Scheduled = scheduled
+			m.updateTask(task)
+		}
+	}
+}
+
+// plan places pending tasks with an estimate, most urgent first, in the free
+// working hours within the sync window.
+func (ctx *cliContext) plan() error {
+	log, err := ctx.makeLogger()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := ctx.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	pc, err := planning(cfg)
+	if err != nil {
+		return err
+	}
+
+	tags, err := ctx.makeTags()
+	if err != nil {
+		return err
+	}
+
+	runCtx, cancel := ctx.runContext()
+	defer cancel()
+
+	lock, err := acquireSyncLock(runCtx, ctx.Bool("wait"), log)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	tw, cal, err := ctx.connect(runCtx, cfg, log)
+	if err != nil {
+		return exitWith(err, nil)
+	}
+
+	filter, err := ctx.taskFilter(runCtx, cfg, tw)
+	if err != nil {
+		return exitWith(err, nil)
+	}
+
+	args := append(append([]string{"export", "status:pending"}, tags.decorate()...), filter...)
+	tasks, err := tw.exportTasksByCommand(runCtx, append(args, ctx.quarantineFilter()...)...)
+	if err != nil {
+		return exitWith(err, nil)
+	}
+
+	estimates := map[*taskWarriorItem]time.Duration{}
+	candidates := taskWarriorItems{}
+
+	for _, task := range tasks {
+		value, ok := task.UDA[pc.Estimate]
+		if !ok {
+			continue
+		}
+
+		estimate, err := parseEstimate(value)
+		if err != nil || estimate <= 0 {
+			log.Warnf("Skipping task %q (%.20q): invalid estimate %v", task.UUID, task.Description, value)
+			continue
+		}
+
+		planned, err := cal.planned(runCtx, task)
+		if err != nil {
+			return exitWith(calendarFailure(fmt.Errorf("Could not retrieve time block %q: %w", task.PlanID, err)), nil)
+		}
+
+		if planned {
+			log.Debugf("Task %q (%.20q) is already planned", task.UUID, task.Description)
+			continue
+		}
+
+		estimates[task] = estimate
+		candidates = append(candidates, task)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Urgency > candidates[j].Urgency })
+
+	t1, t2 := ctx.getTimeWindow()
+	if now := time.Now(); t1.Before(now) {
+		t1 = now
+	}
+
+	busy, err := cal.busySlots(runCtx, t1, t2)
+	if err != nil {
+		return exitWith(calendarFailure(fmt.Errorf("Trouble querying free/busy time: %w", err)), nil)
+	}
+
+	slots := freeSlots(pc.workingSlots(t1, t2), busy)
+
+	batch := &calendarBatch{}
+	planned := taskWarriorItems{}
+	var planErrs syncErrors
+
+	for _, task := range candidates {
+		task := task
+
+		slot, ok := place(slots, estimates[task])
+		if !ok {
+			log.Noticef("No free time for task %q (%.20q), needing %v", task.UUID, task.Description, estimates[task])
+			continue
+		}
+
+		event := &calendar.Event{
+			Id:      planEventID(task),
+			Summary: task.Description,
+			Start:   &calendar.EventDateTime{DateTime: string(toCalendarTime(slot.start)), TimeZone: time.Local.String()},
+			End:     &calendar.EventDateTime{DateTime: string(toCalendarTime(slot.end)), TimeZone: time.Local.String()},
+			ExtendedProperties: &calendar.EventExtendedProperties{
+				Private: map[string]string{planProperty: task.UUID},
+			},
+		}
+
+		batch.insert(event, func(inserted *calendar.Event, err error) {
+			if err != nil {
+				inserted, err = cal.recoverPlan(runCtx, log, task, event, err)
+			}
+
+			var scheduled taskWarriorTime
+			if err == nil {
+				scheduled, err = eventDue(inserted)
+			}
+
+			if err != nil {
+				err = fmt.Errorf("Task %q (%.20q): Error planning time block: %w", task.UUID, task.Description, err)
+				log.ItemError(task, nil, err)
+				planErrs = append(planErrs, err)
+				return
+			}
+
+			log.Noticef("Planned task %q (%.20q) at %s", task.UUID, task.Description, scheduled)
+			task.PlanID = inserted.Id
+			task.Scheduled = scheduled
+			planned = append(planned, task)
+		})
+	}
+
+	cal.runBatch(runCtx, batch)
+
+	if len(planned) > 0 {
+		if err := tw.importTasks(planned); err != nil {
+			return exitWith(taskwarriorFailure(fmt.Errorf("Could not import tasks: %w", err)), nil)
+		}
+	}
+
+	if len(planErrs) > 0 {
+		return exitWith(planErrs, nil)
+	}
+
+	return nil
+}
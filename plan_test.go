@@ -0,0 +1,48 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestWorkingSlotsDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := planning(&config{Plan: &planConfig{Days: []string{"sun"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both days are sundays
+	for _, day := range []time.Time{
+		time.Date(2021, 3, 28, 0, 0, 0, 0, berlin),
+		time.Date(2021, 10, 31, 0, 0, 0, 0, berlin),
+	} {
+		slots := pc.workingSlots(day, day.AddDate(0, 0, 1))
+		if len(slots) != 1 {
+			t.Fatalf("expected one slot on %v, got %v", day, slots)
+		}
+
+		start, end := slots[0].start, slots[0].end
+		if start.Hour() != 9 || start.Minute() != 0 || end.Hour() != 17 || end.Minute() != 0 {
+			t.Fatalf("expected 09:00 to 17:00 on %v, got %v to %v", day, start, end)
+		}
+	}
+}
+
+func TestPlanEventID(t *testing.T) {
+	task := &taskWarriorItem{UUID: "3F2504E0-4F89-11D3-9A0C-0305E82C3301"}
+
+	id := planEventID(task)
+	if !regexp.MustCompile(`^[a-v0-9]{5,}$`).MatchString(id) {
+		t.Fatalf("%q is not a valid event ID", id)
+	}
+
+	if id == eventIDForTask(task) {
+		t.Fatal("the time block ID must differ from the task's event ID")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+const failuresFile = "failures.json"
+
+// quarantineFilter excludes quarantined tasks from the export.
+func (ctx *cliContext) quarantineFilter() []string {
+	if tag := ctx.String("quarantine-tag"); tag != "" {
+		return []string{"-" + tag}
+	}
+
+	return nil
+}
+
+// ignoreQuarantined keeps events linked to quarantined tasks from being
+// treated as new events.
+func (m *merge) ignoreQuarantined(ctx context.Context, tags taskWarriorTags) error {
+	tag := m.ctx.String("quarantine-tag")
+	if tag == "" {
+		return nil
+	}
+
+	tasks, err := m.tw.exportTasksByCommand(ctx, append(append([]string{"export"}, tags.decorate()...), "+"+tag)...)
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		if task.CalendarID != "" {
+			m.ignoredEvents[task.CalendarID] = true
+		}
+	}
+
+	return nil
+}
+
+// quarantine tracks how many runs in a row each task has failed in, and tags
+// the task once it reaches the configured limit so it is left out of future
+// syncs.
+func (m *merge) quarantine(ctx context.Context, tasks taskWarriorItems) error {
+	limit := m.ctx.Int("quarantine")
+	tag := m.ctx.String("quarantine-tag")
+	if limit <= 0 || tag == "" {
+		return nil
+	}
+
+	failures := map[string]int{} // UUID -> consecutive failed runs
+	if err := loadState(failuresFile, &failures); err != nil {
+		return err
+	}
+
+	failed := map[string]bool{}
+	for task := range m.failedTasks {
+		if task.UUID != "" {
+			failed[task.UUID] = true
+		}
+	}
+
+	for _, task := range tasks {
+		if !failed[task.UUID] {
+			delete(failures, task.UUID)
+			continue
+		}
+
+		failures[task.UUID]++
+		if failures[task.UUID] < limit {
+			continue
+		}
+
+		m.log.Warnf("Task %q (%.20q) failed to sync %d times; tagging it +%s", task.UUID, task.Description, failures[task.UUID], tag)
+		if _, err := m.tw.runTask(ctx, task.UUID, "modify", "+"+tag); err != nil {
+			m.log.Error(fmt.Errorf("Could not quarantine task %q: %w", task.UUID, err))
+			continue
+		}
+
+		delete(failures, task.UUID)
+	}
+
+	return saveState(failuresFile, failures)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+type syncCounts struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+// reportItem refers to a task and/or event that needs attention.
+type reportItem struct {
+	Task    string `json:"task,omitempty"`
+	Event   string `json:"event,omitempty"`
+	Message string `json:"message"`
+}
+
+// syncReport is the machine-readable summary of a sync run.
+type syncReport struct {
+	Start       time.Time    `json:"start"`
+	End         time.Time    `json:"end"`
+	Success     bool         `json:"success"`
+	Calendar    syncCounts   `json:"calendar"`
+	Taskwarrior syncCounts   `json:"taskwarrior"`
+	Conflicts   []reportItem `json:"conflicts"`
+	Errors      []reportItem `json:"errors"`
+	Skipped     []reportItem `json:"skipped"`
+
+	mutex sync.Mutex
+}
+
+func newSyncReport() *syncReport {
+	return &syncReport{
+		Start:     time.Now().UTC(),
+		Conflicts: []reportItem{},
+		Errors:    []reportItem{},
+		Skipped:   []reportItem{},
+	}
+}
+
+func makeReportItem(task *taskWarriorItem, event *calendar.Event, message string) reportItem {
+	item := reportItem{Message: message}
+
+	if task != nil {
+		item.Task = task.UUID
+		item.Event = task.CalendarID
+	}
+
+	if event != nil {
+		item.Event = event.Id
+	}
+
+	return item
+}
+
+func (r *syncReport) addConflict(task *taskWarriorItem, event *calendar.Event, message string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Conflicts = append(r.Conflicts, makeReportItem(task, event, message))
+}
+
+func (r *syncReport) addError(task *taskWarriorItem, event *calendar.Event, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Errors = append(r.Errors, makeReportItem(task, event, err.Error()))
+}
+
+func (r *syncReport) addSkipped(task *taskWarriorItem, reason string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Skipped = append(r.Skipped, makeReportItem(task, nil, reason))
+}
+
+// count applies f to the report's counters while holding the lock.
+func (r *syncReport) count(f func(r *syncReport)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	f(r)
+}
+
+func (r *syncReport) finish() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.End = time.Now().UTC()
+	r.Success = len(r.Errors) == 0
+}
+
+func (r *syncReport) write(format string, w io.Writer) error {
+	switch format {
+	case "":
+		return nil
+	case "json":
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		return json.NewEncoder(w).Encode(r)
+	default:
+		return fmt.Errorf("Invalid report format %q: must be json", format)
+	}
+}
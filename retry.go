@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 32 * time.Second
+)
+
+// retryTransport retries calendar API requests that failed because of rate
+// limiting or a server error, backing off exponentially with jitter. Retries
+// stop once the next attempt would exceed the budget, at which point the last
+// response is returned as-is.
+type retryTransport struct {
+	base   http.RoundTripper
+	budget time.Duration
+	log    logger
+}
+
+func newRetryTransport(base http.RoundTripper, budget time.Duration, log logger) *retryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &retryTransport{base: base, budget: budget, log: log}
+}
+
+func (rt *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	for attempt := 0; ; attempt++ {
+		try := req
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				// cannot replay the body
+				return rt.base.RoundTrip(req)
+			}
+
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			try = req.Clone(req.Context())
+			try.Body = body
+		}
+
+		resp, err := rt.base.RoundTrip(try)
+		if err != nil || !retryable(resp) {
+			return resp, err
+		}
+
+		delay := retryDelay(resp, attempt)
+		if time.Since(start)+delay > rt.budget {
+			return resp, nil
+		}
+
+		if rt.log != nil {
+			rt.log.Debugf("Calendar API returned %d for %s %s; retrying in %v", resp.StatusCode, req.Method, req.URL.Path, delay)
+		}
+
+		// drain so the connection can be reused
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryable reports whether the response is a rate limit or server error.
+func retryable(resp *http.Response) bool {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode >= 500:
+		return true
+	case resp.StatusCode == http.StatusForbidden:
+		// google reports quota problems as 403s; only those are worth retrying.
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return false
+		}
+
+		return strings.Contains(string(body), "rateLimitExceeded") // also matches userRateLimitExceeded
+	}
+
+	return false
+}
+
+// retryDelay honours Retry-After if the server sent it, otherwise backs off
+// exponentially with jitter.
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if after := resp.Header.Get("Retry-After"); after != "" {
+		if secs, err := strconv.Atoi(after); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+
+		if t, err := http.ParseTime(after); err == nil {
+			if d := time.Until(t); d > 0 {
+				return d
+			}
+
+			return 0
+		}
+	}
+
+	delay := retryMaxDelay
+	if attempt < 16 {
+		if d := retryBaseDelay << uint(attempt); d < retryMaxDelay {
+			delay = d
+		}
+	}
+
+	// between half and all of the delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	rateLimitBody = `{"error":{"errors":[{"domain":"usageLimits","reason":"rateLimitExceeded"}],"code":403,"message":"Rate Limit Exceeded"}}`
+	forbiddenBody = `{"error":{"errors":[{"domain":"calendar","reason":"forbiddenForNonOrganizer"}],"code":403,"message":"Forbidden"}}`
+)
+
+type fakeResponse struct {
+	status     int
+	retryAfter string
+	body       string
+}
+
+// fakeCalendar serves the responses in turn, repeating the last one, and
+// records the bodies of the requests it received.
+type fakeCalendar struct {
+	*httptest.Server
+
+	mutex     sync.Mutex
+	responses []fakeResponse
+	bodies    []string
+}
+
+func newFakeCalendar(responses ...fakeResponse) *fakeCalendar {
+	fc := &fakeCalendar{responses: responses}
+
+	fc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		fc.mutex.Lock()
+		resp := fc.responses[len(fc.responses)-1]
+		if len(fc.bodies) < len(fc.responses) {
+			resp = fc.responses[len(fc.bodies)]
+		}
+		fc.bodies = append(fc.bodies, string(body))
+		fc.mutex.Unlock()
+
+		if resp.retryAfter != "" {
+			w.Header().Set("Retry-After", resp.retryAfter)
+		}
+		w.WriteHeader(resp.status)
+		w.Write([]byte(resp.body))
+	}))
+
+	return fc
+}
+
+func (fc *fakeCalendar) requests() []string {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	return append([]string{}, fc.bodies...)
+}
+
+func TestRetryTransport(t *testing.T) {
+	table := []struct {
+		name      string
+		responses []fakeResponse
+		status    int
+		requests  int
+	}{
+		{
+			name:      "too many requests",
+			responses: []fakeResponse{{status: 429, retryAfter: "0"}, {status: 200, body: "{}"}},
+			status:    200,
+			requests:  2,
+		},
+		{
+			name:      "server errors",
+			responses: []fakeResponse{{status: 500, retryAfter: "0"}, {status: 503, retryAfter: "0"}, {status: 200, body: "{}"}},
+			status:    200,
+			requests:  3,
+		},
+		{
+			name:      "rate limit exceeded",
+			responses: []fakeResponse{{status: 403, retryAfter: "0", body: rateLimitBody}, {status: 200, body: "{}"}},
+			status:    200,
+			requests:  2,
+		},
+		{
+			name:      "plain forbidden",
+			responses: []fakeResponse{{status: 403, retryAfter: "0", body: forbiddenBody}, {status: 200, body: "{}"}},
+			status:    403,
+			requests:  1,
+		},
+		{
+			name:      "not found",
+			responses: []fakeResponse{{status: 404}, {status: 200, body: "{}"}},
+			status:    404,
+			requests:  1,
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			fc := newFakeCalendar(test.responses...)
+			defer fc.Close()
+
+			client := &http.Client{Transport: newRetryTransport(nil, time.Minute, nil)}
+			resp, err := client.Get(fc.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, resp.StatusCode)
+			}
+
+			if want := test.responses[len(fc.requests())-1].body; string(body) != want {
+				t.Fatalf("expected body %q, got %q", want, body)
+			}
+
+			if requests := len(fc.requests()); requests != test.requests {
+				t.Fatalf("expected %d requests, got %d", test.requests, requests)
+			}
+		})
+	}
+}
+
+func TestRetryTransportRetryAfter(t *testing.T) {
+	fc := newFakeCalendar(fakeResponse{status: 429, retryAfter: "1"}, fakeResponse{status: 200})
+	defer fc.Close()
+
+	client := &http.Client{Transport: newRetryTransport(nil, time.Minute, nil)}
+
+	start := time.Now()
+	resp, err := client.Get(fc.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected to wait for Retry-After, waited %v", elapsed)
+	}
+}
+
+func TestRetryTransportBudget(t *testing.T) {
+	fc := newFakeCalendar(fakeResponse{status: 503, retryAfter: "10"})
+	defer fc.Close()
+
+	client := &http.Client{Transport: newRetryTransport(nil, 5*time.Second, nil)}
+
+	start := time.Now()
+	resp, err := client.Get(fc.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 503 {
+		t.Fatalf("expected the last response once the budget is spent, got %d", resp.StatusCode)
+	}
+
+	if requests := len(fc.requests()); requests != 1 {
+		t.Fatalf("expected 1 request, got %d", requests)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected no wait beyond the budget, waited %v", elapsed)
+	}
+}
+
+func TestRetryTransportReplaysBody(t *testing.T) {
+	fc := newFakeCalendar(fakeResponse{status: 500, retryAfter: "0"}, fakeResponse{status: 200})
+	defer fc.Close()
+
+	client := &http.Client{Transport: newRetryTransport(nil, time.Minute, nil)}
+
+	const payload = `{"summary":"Call Bob"}`
+	resp, err := client.Post(fc.URL, "application/json", strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	requests := fc.requests()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+
+	for i, body := range requests {
+		if body != payload {
+			t.Fatalf("request %d: expected body %q, got %q", i, payload, body)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	header := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": {value}}}
+	}
+
+	if d := retryDelay(header("3"), 0); d != 3*time.Second {
+		t.Fatalf("expected 3s from seconds, got %v", d)
+	}
+
+	date := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if d := retryDelay(header(date), 0); d <= 8*time.Second || d > 10*time.Second {
+		t.Fatalf("expected about 10s from a date, got %v", d)
+	}
+
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	if d := retryDelay(header(past), 0); d != 0 {
+		t.Fatalf("expected no delay for a date in the past, got %v", d)
+	}
+
+	for attempt := 0; attempt < 20; attempt++ {
+		max := retryMaxDelay
+		if attempt < 16 && retryBaseDelay<<uint(attempt) < retryMaxDelay {
+			max = retryBaseDelay << uint(attempt)
+		}
+
+		if d := retryDelay(&http.Response{Header: http.Header{}}, attempt); d < max/2 || d > max {
+			t.Fatalf("attempt %d: expected a delay between %v and %v, got %v", attempt, max/2, max, d)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// attendee response statuses
+const (
+	responseAccepted  = "accepted"
+	responseDeclined  = "declined"
+	responseTentative = "tentative"
+)
+
+func selfAttendee(event *calendar.Event) *calendar.EventAttendee {
+	for _, attendee := range event.Attendees {
+		if attendee.Self {
+			return attendee
+		}
+	}
+
+	return nil
+}
+
+// eventResponse is our response to the event's invitation, or "" if we were
+// not invited (e.g. it is our own event without guests).
+func eventResponse(event *calendar.Event) string {
+	if attendee := selfAttendee(event); attendee != nil {
+		return attendee.ResponseStatus
+	}
+
+	return ""
+}
+
+func setEventResponse(event *calendar.Event, response string) {
+	switch response {
+	case "needsAction", responseAccepted, responseDeclined, responseTentative:
+	default:
+		return
+	}
+
+	if attendee := selfAttendee(event); attendee != nil {
+		attendee.ResponseStatus = response
+	}
+}
+
+// applyResponse updates the task for our response to the event: tasks for
+// declined events are completed or deleted (per --declined), and tasks for
+// tentative ones are tagged. The tag is recorded in the task so it is only
+// removed again if calwarrior added it.
+func (m *merge) applyResponse(task *taskWarriorItem, event *calendar.Event) bool {
+	modified := false
+	response := eventResponse(event)
+
+	if tag := m.ctx.String("tentative-tag"); tag != "" && response == responseTentative {
+		// a tag the user added already is theirs to remove
+		if tags := (taskWarriorTags{tag}).addTo(task.Tags); len(tags) != len(task.Tags) {
+			task.Tags = tags
+			task.TentativeTag = tag
+			modified = true
+		}
+	}
+
+	if response != responseTentative && task.TentativeTag != "" {
+		tags := []string{}
+		for _, t := range task.Tags {
+			if t != task.TentativeTag {
+				tags = append(tags, t)
+			}
+		}
+
+		task.Tags = tags
+		task.TentativeTag = ""
+		modified = true
+	}
+
+	if response == responseDeclined && task.Status == "pending" {
+		status := "completed"
+		if m.ctx.String("declined") == "delete" {
+			status = "deleted"
+		}
+
+		m.log.Noticef("Event %q (%.20q) was declined; marking task %q %s", event.Id, event.Summary, task.UUID, status)
+		task.Status = status
+		task.End = toTaskWarriorTime(time.Now())
+		modified = true
+	}
+
+	return modified
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestApplyResponseTentativeTag(t *testing.T) {
+	table := []struct {
+		name      string
+		tags      []string
+		added     string
+		response  string
+		modified  bool
+		wantTags  string
+		wantAdded string
+	}{
+		{"tentative", []string{"calendar"}, "", responseTentative, true, "calendar,tentative", "tentative"},
+		{"still tentative", []string{"calendar", "tentative"}, "tentative", responseTentative, false, "calendar,tentative", "tentative"},
+		{"accepted after tentative", []string{"calendar", "tentative"}, "tentative", responseAccepted, true, "calendar", ""},
+		{"tagged by the user and accepted", []string{"calendar", "tentative"}, "", responseAccepted, false, "calendar,tentative", ""},
+		{"tagged by the user and tentative", []string{"calendar", "tentative"}, "", responseTentative, false, "calendar,tentative", ""},
+		{"tag removed by the user", []string{"calendar"}, "tentative", responseAccepted, true, "calendar", ""},
+		{"not invited", []string{"calendar", "tentative"}, "", "", false, "calendar,tentative", ""},
+	}
+
+	m := testMerge(t, &config{}, &datesConfig{Start: dateDue})
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			task := &taskWarriorItem{Status: "pending", Tags: test.tags, TentativeTag: test.added}
+
+			event := &calendar.Event{}
+			if test.response != "" {
+				event.Attendees = []*calendar.EventAttendee{{Self: true, ResponseStatus: test.response}}
+			}
+
+			if modified := m.applyResponse(task, event); modified != test.modified {
+				t.Fatalf("expected modified to be %v", test.modified)
+			}
+
+			if tags := strings.Join(task.Tags, ","); tags != test.wantTags {
+				t.Fatalf("expected tags %q, got %q", test.wantTags, tags)
+			}
+
+			if task.TentativeTag != test.wantAdded {
+				t.Fatalf("expected the added tag to be recorded as %q, got %q", test.wantAdded, task.TentativeTag)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -42,3 +45,45 @@ func findLauncher() (string, bool) {
 
 	return "", false
 }
+
+// loadState reads the named JSON state file from the settings directory into
+// v. A missing file leaves v untouched.
+func loadState(name string, v interface{}) error {
+	dir, err := findSettingsDir()
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Trouble reading state file %q: %w", name, err)
+	}
+
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("Trouble parsing state file %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// saveState writes v as JSON to the named state file in the settings
+// directory.
+func saveState(name string, v interface{}) error {
+	dir, err := findSettingsDir()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+		return fmt.Errorf("Trouble writing state file %q: %w", name, err)
+	}
+
+	return nil
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"google.golang.org/api/calendar/v3"
@@ -14,38 +18,125 @@ const twTimeFormat = "20060102T150405Z"
 
 type taskWarrior struct {
 	path string
+	rc   []string // configuration arguments passed to every command
 }
 
-func findTaskwarrior() (*taskWarrior, error) {
-	for _, path := range []string{"task", "taskw"} {
+// taskwarriorConfig selects the taskwarrior binary and task database.
+type taskwarriorConfig struct {
+	Binary    string            `json:"binary"`    // default: task or taskw from $PATH
+	RC        string            `json:"rc"`        // the .taskrc to use
+	Data      string            `json:"data"`      // the data directory to use
+	Overrides map[string]string `json:"overrides"` // further rc settings, e.g. {"weekstart": "monday"}
+}
+
+// findTaskwarrior finds the taskwarrior binary, in $PATH unless configured.
+func findTaskwarrior(cfg *taskwarriorConfig) (*taskWarrior, error) {
+	paths := []string{"task", "taskw"}
+	if cfg.Binary != "" {
+		paths = []string{cfg.Binary}
+	}
+
+	for _, path := range paths {
 		s, err := exec.LookPath(path)
 		if err == nil {
-			return &taskWarrior{path: s}, nil
+			return &taskWarrior{path: s, rc: cfg.args()}, nil
 		}
 	}
 
 	return nil, errors.New("Could not find taskwarrior")
 }
 
-func (tw *taskWarrior) runTask(args ...string) ([]byte, error) {
-	return exec.Command(tw.path, args...).Output()
+// args returns the arguments passing the configuration to taskwarrior.
+// Commands are never interactive.
+func (cfg *taskwarriorConfig) args() []string {
+	args := []string{}
+
+	if cfg.RC != "" {
+		args = append(args, "rc:"+cfg.RC)
+	}
+
+	if cfg.Data != "" {
+		args = append(args, "rc.data.location="+cfg.Data)
+	}
+
+	names := []string{}
+	for name := range cfg.Overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		args = append(args, "rc."+strings.TrimPrefix(name, "rc.")+"="+cfg.Overrides[name])
+	}
+
+	return append(args, "rc.confirmation=off")
+}
+
+// taskwarrior returns the taskwarrior settings, with --task-binary, --taskrc,
+// --taskdata and --task-rc overriding the configuration.
+func (ctx *cliContext) taskwarrior(cfg *config) (*taskwarriorConfig, error) {
+	tc := taskwarriorConfig{}
+	if cfg.Taskwarrior != nil {
+		tc = *cfg.Taskwarrior
+	}
+
+	if binary := ctx.String("task-binary"); binary != "" {
+		tc.Binary = binary
+	}
+
+	if rc := ctx.String("taskrc"); rc != "" {
+		tc.RC = rc
+	}
+
+	if data := ctx.String("taskdata"); data != "" {
+		tc.Data = data
+	}
+
+	overrides := map[string]string{}
+	for name, value := range tc.Overrides {
+		overrides[name] = value
+	}
+
+	for _, override := range ctx.StringSlice("task-rc") {
+		parts := strings.SplitN(override, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid taskwarrior setting %q: must be name=value", override)
+		}
+		overrides[parts[0]] = parts[1]
+	}
+	tc.Overrides = overrides
+
+	return &tc, nil
+}
+
+func (tw *taskWarrior) runTask(ctx context.Context, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, tw.path, append(append([]string{}, tw.rc...), args...)...).Output()
+}
+
+// readTask runs a command which only reads. Hooks are disabled, so they
+// cannot interfere with the output.
+func (tw *taskWarrior) readTask(ctx context.Context, args ...string) ([]byte, error) {
+	return tw.runTask(ctx, append([]string{"rc.hooks=off"}, args...)...)
 }
 
 // runs the command and attempts to read the tasks. `export` argument
 // is required in your args stanza.
 // f.e.: `export all`
-func (tw *taskWarrior) exportTasksByCommand(args ...string) (taskWarriorItems, error) {
-	out, err := tw.runTask(args...)
+// The active context is not applied; see taskFilter.
+func (tw *taskWarrior) exportTasksByCommand(ctx context.Context, args ...string) (taskWarriorItems, error) {
+	out, err := tw.readTask(ctx, append([]string{"rc.context=none", "rc.json.array=on"}, args...)...)
 	if err != nil {
-		return nil, fmt.Errorf("Could not export tasks: %w", err)
+		return nil, taskwarriorFailure(fmt.Errorf("Could not export tasks: %w", err))
 	}
 
 	items := taskWarriorItems{}
 	return items, items.unmarshalItems(out)
 }
 
+// importTasks imports the items. It deliberately does not take a context;
+// once started, an import should finish rather than be interrupted.
 func (tw *taskWarrior) importTasks(items taskWarriorItems) error {
-	cmd := exec.Command(tw.path, "import")
+	cmd := exec.Command(tw.path, append(append([]string{}, tw.rc...), "import")...)
 
 	pipe, err := cmd.StdinPipe()
 	if err != nil {
@@ -80,12 +171,18 @@ func (twt taskWarriorTime) ToTime() (time.Time, error) {
 }
 
 func (twt taskWarriorTime) ToGCal() (*calendar.EventDateTime, error) {
+	return twt.ToGCalIn(time.Local)
+}
+
+// ToGCalIn converts the time to a calendar time scheduled in loc, so events
+// created in another time zone keep it.
+func (twt taskWarriorTime) ToGCalIn(loc *time.Location) (*calendar.EventDateTime, error) {
 	t, err := twt.ToTime()
 	if err != nil {
 		return nil, err
 	}
 
-	return &calendar.EventDateTime{DateTime: string(toCalendarTime(t)), TimeZone: time.Local.String()}, nil
+	return &calendar.EventDateTime{DateTime: string(toCalendarTime(t.In(loc))), TimeZone: loc.String()}, nil
 }
 
 func toTaskWarriorTime(t time.Time) taskWarriorTime {
@@ -95,28 +192,112 @@ func toTaskWarriorTime(t time.Time) taskWarriorTime {
 type taskWarriorItems []*taskWarriorItem
 
 type taskWarriorItem struct {
-	ID          int             `json:"id"`
-	Status      string          `json:"status"`
-	UUID        string          `json:"uuid"`
+	ID           int                     `json:"id"`
+	Status       string                  `json:"status"`
+	UUID         string                  `json:"uuid"`
+	Entry        taskWarriorTime         `json:"entry"`
+	Description  string                  `json:"description"`
+	Start        taskWarriorTime         `json:"start,omitempty"`
+	End          taskWarriorTime         `json:"end,omitempty"`
+	Due          taskWarriorTime         `json:"due,omitempty"`
+	Until        taskWarriorTime         `json:"until,omitempty"`
+	Wait         taskWarriorTime         `json:"wait,omitempty"`
+	Modified     taskWarriorTime         `json:"modified,omitempty"`
+	Scheduled    taskWarriorTime         `json:"scheduled,omitempty"`
+	Recur        string                  `json:"recur,omitempty"`
+	Mask         string                  `json:"mask,omitempty"`
+	IMask        float64                 `json:"imask,omitempty"`
+	Parent       string                  `json:"parent,omitempty"`
+	Project      string                  `json:"project,omitempty"`
+	Priority     string                  `json:"priority,omitempty"`
+	Depends      string                  `json:"depends,omitempty"`
+	Tags         []string                `json:"tags,omitempty"`
+	Annotations  []taskWarriorAnnotation `json:"annotations,omitempty"`
+	CalendarID   string                  `json:"udf.calwarrior.id,omitempty"`
+	PlanID       string                  `json:"udf.calwarrior.plan,omitempty"`
+	DeadlineID   string                  `json:"udf.calwarrior.deadline,omitempty"`
+	SomedayID    string                  `json:"udf.calwarrior.someday,omitempty"`
+	TentativeTag string                  `json:"udf.calwarrior.tentative,omitempty"`
+
+	// Urgency is computed by taskwarrior; it is read on export but never
+	// imported.
+	Urgency float64 `json:"-"`
+
+	// UDA holds the attributes not covered above, so they survive import.
+	UDA map[string]interface{} `json:"-"`
+}
+
+type taskWarriorAnnotation struct {
 	Entry       taskWarriorTime `json:"entry"`
 	Description string          `json:"description"`
-	Start       taskWarriorTime `json:"start,omitempty"`
-	End         taskWarriorTime `json:"end,omitempty"`
-	Due         taskWarriorTime `json:"due,omitempty"`
-	Until       taskWarriorTime `json:"until,omitempty"`
-	Wait        taskWarriorTime `json:"wait,omitempty"`
-	Modified    taskWarriorTime `json:"modified,omitempty"`
-	Scheduled   taskWarriorTime `json:"scheduled,omitempty"`
-	Recur       string          `json:"recur,omitempty"`
-	Mask        string          `json:"mask,omitempty"`
-	IMask       float64         `json:"imask,omitempty"`
-	Parent      string          `json:"parent,omitempty"`
-	Project     string          `json:"project,omitempty"`
-	Priority    string          `json:"priority,omitempty"`
-	Depends     string          `json:"depends,omitempty"`
-	Tags        []string        `json:"tags,omitempty"`
-	Annotation  []string        `json:"annotation,omitempty"`
-	CalendarID  string          `json:"udf.calwarrior.id,omitempty"`
+}
+
+// attributes taskwarrior computes itself; these are not carried as UDAs.
+var computedTaskFields = []string{"urgency"}
+
+// taskFieldNames returns the JSON names of the attributes in
+// taskWarriorItem's fields.
+func taskFieldNames() []string {
+	names := []string{}
+
+	t := reflect.TypeOf(taskWarriorItem{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// this alias has no methods, so it can be (un)marshaled without recursion.
+type plainTaskWarriorItem taskWarriorItem
+
+func (twi *taskWarriorItem) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, (*plainTaskWarriorItem)(twi)); err != nil {
+		return err
+	}
+
+	all := map[string]interface{}{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return err
+	}
+
+	if urgency, ok := all["urgency"].(float64); ok {
+		twi.Urgency = urgency
+	}
+
+	for _, name := range append(taskFieldNames(), computedTaskFields...) {
+		delete(all, name)
+	}
+
+	twi.UDA = nil
+	if len(all) > 0 {
+		twi.UDA = all
+	}
+
+	return nil
+}
+
+func (twi taskWarriorItem) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(plainTaskWarriorItem(twi))
+	if err != nil || len(twi.UDA) == 0 {
+		return b, err
+	}
+
+	all := map[string]interface{}{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+
+	for name, value := range twi.UDA {
+		if _, ok := all[name]; !ok {
+			all[name] = value
+		}
+	}
+
+	return json.Marshal(all)
 }
 
 func (twi *taskWarriorItems) unmarshalItems(out []byte) error {
@@ -129,6 +310,22 @@ func (twi *taskWarriorItems) unmarshalItems(out []byte) error {
 
 type taskWarriorTags []string
 
+// addTo returns tags with any of twt that are missing appended.
+func (twt taskWarriorTags) addTo(tags []string) []string {
+	have := map[string]bool{}
+	for _, tag := range tags {
+		have[tag] = true
+	}
+
+	for _, tag := range twt {
+		if !have[tag] {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
 func (twt taskWarriorTags) decorate() []string {
 	tags := []string{}
 
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	timeLogFile = "timelog.json"
+	// marks time log events, so they are not imported as tasks.
+	timeLogProperty = "calwarriorTimeLog"
+)
+
+// taskwarrior annotates started and stopped tasks with these when
+// journal.time is on.
+const (
+	journalStarted = "Started task"
+	journalStopped = "Stopped task"
+)
+
+// timeLogState tracks which work intervals have been logged, and which tasks
+// were seen running so the interval can be logged once they are stopped.
+type timeLogState struct {
+	Running map[string]taskWarriorTime `json:"running"` // task UUID -> start
+	Logged  map[string]string          `json:"logged"`  // interval key -> event ID
+}
+
+type workInterval struct {
+	task       *taskWarriorItem
+	start, end time.Time
+	running    bool // derived from the start time seen on an earlier run
+}
+
+// key identifies the interval, so each start/stop session is logged once.
+func (wi workInterval) key() string {
+	return wi.task.UUID + "@" + string(toTaskWarriorTime(wi.start))
+}
+
+// eventID is derived from the task and start time, so a retried insert
+// cannot log the same interval twice.
+func (wi workInterval) eventID() string {
+	return eventIDForTask(wi.task) + strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, string(toTaskWarriorTime(wi.start)))
+}
+
+func eventIsTimeLog(event *calendar.Event) bool {
+	return event.ExtendedProperties != nil && event.ExtendedProperties.Private[timeLogProperty] != ""
+}
+
+// journalIntervals pairs up the start and stop annotations taskwarrior adds
+// with journal.time on. A task completed while running ends at its end time.
+func journalIntervals(task *taskWarriorItem) []workInterval {
+	intervals := []workInterval{}
+
+	var started *time.Time
+	for _, annotation := range task.Annotations {
+		t, err := annotation.Entry.ToTime()
+		if err != nil {
+			continue
+		}
+
+		switch annotation.Description {
+		case journalStarted:
+			started = &t
+		case journalStopped:
+			if started != nil {
+				intervals = append(intervals, workInterval{task: task, start: *started, end: t})
+				started = nil
+			}
+		}
+	}
+
+	if started != nil && task.Start == "" {
+		if end, err := task.End.ToTime(); err == nil {
+			intervals = append(intervals, workInterval{task: task, start: *started, end: end})
+		}
+	}
+
+	return intervals
+}
+
+// workIntervals finds the finished work intervals of the tasks, from journal
+// annotations or, failing that, from the start times seen on earlier runs.
+func (state *timeLogState) workIntervals(tasks taskWarriorItems) []workInterval {
+	intervals := []workInterval{}
+
+	for _, task := range tasks {
+		journal := journalIntervals(task)
+		intervals = append(intervals, journal...)
+
+		if task.Start != "" {
+			state.Running[task.UUID] = task.Start
+			continue
+		}
+
+		start, ok := state.Running[task.UUID]
+		if !ok {
+			continue
+		}
+
+		if len(journal) > 0 {
+			delete(state.Running, task.UUID)
+			continue
+		}
+
+		// stopping (or completing) the task modifies it, so that is when it
+		// stopped.
+		stop := task.End
+		if stop == "" {
+			stop = task.Modified
+		}
+
+		s, err := start.ToTime()
+		if err != nil {
+			delete(state.Running, task.UUID)
+			continue
+		}
+
+		e, err := stop.ToTime()
+		if err != nil || !e.After(s) {
+			delete(state.Running, task.UUID)
+			continue
+		}
+
+		// the start is kept until the interval is logged, so a failed insert
+		// is retried on the next run.
+		intervals = append(intervals, workInterval{task: task, start: s, end: e, running: true})
+	}
+
+	return intervals
+}
+
+// logged records that the interval is on the time log calendar.
+func (state *timeLogState) logged(interval workInterval, id string) {
+	state.Logged[interval.key()] = id
+
+	if interval.running {
+		delete(state.Running, interval.task.UUID)
+	}
+}
+
+// logTime records the finished work intervals of the tasks as events on the
+// time log calendar.
+func (m *merge) logTime(tasks taskWarriorItems) (*timeLogState, error) {
+	calID := m.ctx.String("time-log-calendar")
+	if calID == "" {
+		return nil, nil
+	}
+
+	state := &timeLogState{Running: map[string]taskWarriorTime{}, Logged: map[string]string{}}
+	if err := loadState(timeLogFile, state); err != nil {
+		return nil, err
+	}
+
+	for _, interval := range state.workIntervals(tasks) {
+		interval := interval
+		if id, ok := state.Logged[interval.key()]; ok {
+			state.logged(interval, id)
+			continue
+		}
+
+		event := &calendar.Event{
+			Id:      interval.eventID(),
+			Summary: interval.task.Description,
+			Start:   &calendar.EventDateTime{DateTime: string(toCalendarTime(interval.start.In(time.Local))), TimeZone: time.Local.String()},
+			End:     &calendar.EventDateTime{DateTime: string(toCalendarTime(interval.end.In(time.Local))), TimeZone: time.Local.String()},
+			ExtendedProperties: &calendar.EventExtendedProperties{
+				Private: map[string]string{timeLogProperty: interval.task.UUID},
+			},
+		}
+
+		m.log.Debugf("Logging work on %q (%.20q) from %v to %v", interval.task.UUID, interval.task.Description, interval.start, interval.end)
+
+		m.batch.insertIn(calID, event, func(inserted *calendar.Event, err error) {
+			if err != nil && !isConflict(err) {
+				m.itemFailed(interval.task, nil, fmt.Errorf("Error logging time: %w", err))
+				return
+			}
+
+			// a conflict means an earlier run logged it already
+			state.logged(interval, event.Id)
+			if err == nil {
+				m.report.count(func(r *syncReport) { r.Calendar.Created++ })
+			}
+		})
+	}
+
+	return state, nil
+}
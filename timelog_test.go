@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestLogTimeKeepsFailedIntervals(t *testing.T) {
+	withSettingsDir(t)
+
+	task := &taskWarriorItem{
+		UUID:        "3f2504e0-4f89-11d3-9a0c-0305e82c3301",
+		Status:      "pending",
+		Description: "Write report",
+		Modified:    "20210601T110000Z", // stopped
+	}
+
+	// seen running on an earlier run
+	running := &timeLogState{Running: map[string]taskWarriorTime{task.UUID: "20210601T090000Z"}, Logged: map[string]string{}}
+	if err := saveState(timeLogFile, running); err != nil {
+		t.Fatal(err)
+	}
+
+	for run, result := range []error{&googleapi.Error{Code: http.StatusForbidden}, nil} {
+		m := testMerge(t, &config{}, &datesConfig{Start: dateDue}, "--time-log-calendar", "worklog")
+
+		state, err := m.logTime(taskWarriorItems{task})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m.batch.ops) != 1 {
+			t.Fatalf("run %d: expected the interval to be logged, got %d operations", run, len(m.batch.ops))
+		}
+
+		op := m.batch.ops[0]
+		if result == nil {
+			op.done(op.event, nil)
+		} else {
+			op.done(nil, result)
+		}
+
+		if err := saveState(timeLogFile, state); err != nil {
+			t.Fatal(err)
+		}
+
+		_, stillRunning := state.Running[task.UUID]
+		if stillRunning != (result != nil) {
+			t.Fatalf("run %d: expected the start to be kept only while the interval is not logged", run)
+		}
+	}
+
+	m := testMerge(t, &config{}, &datesConfig{Start: dateDue}, "--time-log-calendar", "worklog")
+	if _, err := m.logTime(taskWarriorItems{task}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.batch.ops) != 0 {
+		t.Fatalf("expected the logged interval not to be logged again, got %d operations", len(m.batch.ops))
+	}
+}
+
+func TestLogTimeConflict(t *testing.T) {
+	withSettingsDir(t)
+
+	task := &taskWarriorItem{UUID: "3f2504e0-4f89-11d3-9a0c-0305e82c3301", Modified: "20210601T110000Z"}
+
+	if err := saveState(timeLogFile, &timeLogState{Running: map[string]taskWarriorTime{task.UUID: "20210601T090000Z"}, Logged: map[string]string{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := testMerge(t, &config{}, &datesConfig{Start: dateDue}, "--time-log-calendar", "worklog")
+
+	state, err := m.logTime(taskWarriorItems{task})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// logged by a run which could not save its state
+	m.batch.ops[0].done(nil, &googleapi.Error{Code: http.StatusConflict})
+
+	if _, ok := state.Running[task.UUID]; ok || len(state.Logged) != 1 || len(m.errors) > 0 {
+		t.Fatalf("expected the interval to count as logged, got %+v (%v)", state, m.errors)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+)
+
+// what happens to linked tasks whose events are outside the time window
+const (
+	outsideFetch  = "fetch"
+	outsideFreeze = "freeze"
+)
+
+func (ctx *cliContext) outsideWindow() (string, error) {
+	switch policy := ctx.String("outside-window"); policy {
+	case outsideFetch, outsideFreeze:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Invalid --outside-window value %q: must be fetch or freeze", policy)
+	}
+}
+
+// selectOutsideWindow decides which linked tasks with events outside the time
+// window are reconciled. Pending tasks are, by fetching their events one by
+// one, unless they are frozen; closed tasks only with --full. The others are
+// left alone until their events are back in the window.
+func (m *merge) selectOutsideWindow() {
+	full := m.ctx.Bool("full")
+	freeze := m.ctx.String("outside-window") == outsideFreeze
+
+	selected := taskWarriorItems{}
+
+	for _, task := range m.checkTasks {
+		_, inWindow := m.eventsIDMap[task.CalendarID]
+		if task.CalendarID == "" || inWindow || full || (task.Status == "pending" && !freeze) {
+			selected = append(selected, task)
+			continue
+		}
+
+		m.log.Debugf("Leaving task %q (%.20q) alone: its event is outside the time window", task.UUID, task.Description)
+	}
+
+	m.checkTasks = selected
+}
+
+// deleteClosedOutsideWindow queues the deletion of events of tasks closed
+// while their events were outside the time window. Their events are only
+// fetched with --full.
+func (m *merge) deleteClosedOutsideWindow() {
+	for _, task := range m.checkTasks {
+		if (task.Status != "deleted" && task.Status != "completed") || m.keepsCompletedEvent(task) {
+			continue
+		}
+
+		if _, ok := m.deletedTaskCalMap[task.CalendarID]; ok {
+			continue
+		}
+
+		event, ok := m.eventsIDMap[task.CalendarID]
+		if !ok || event.Status == "cancelled" || eventResponse(event) == responseDeclined {
+			continue
+		}
+
+		m.deletedTasks = append(m.deletedTasks, task)
+		m.deletedTaskCalMap[task.CalendarID] = task
+	}
+}